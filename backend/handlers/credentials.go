@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"urumi-backend/models"
+	"urumi-backend/orchestrator"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetCredentials reveals the store's generated credentials. Every reveal is
+// recorded in the store's timeline. With RevealCredentialsOnce set they can
+// only be revealed once, until the next rotation.
+func (h *StoreHandler) GetCredentials(c *gin.Context) {
+	id := c.Param("id")
+	var store models.Store
+	if result := h.DB.First(&store, "id = ?", id); result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		} else {
+			log.Printf("Database error when fetching store %s: %v", id, result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	creds, err := h.Provisioner.Credentials(c.Request.Context(), store)
+	if errors.Is(err, orchestrator.ErrCredentialsNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Store has no credentials yet"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read credentials of store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read credentials"})
+		return
+	}
+
+	client := fmt.Sprintf("client %s", c.ClientIP())
+	if _, err := models.MarkCredentialsRevealed(h.DB, store.ID, h.RevealCredentialsOnce); err != nil {
+		if errors.Is(err, models.ErrCredentialsRevealed) {
+			models.RecordEvent(h.DB, store.ID, models.EventCredentialsViewed, models.ActorAPI, "credentials reveal refused, already revealed", client)
+			c.JSON(http.StatusGone, gin.H{"error": "Credentials were already revealed, rotate them to reveal new ones"})
+			return
+		}
+		log.Printf("Failed to record credentials reveal for store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	log.Printf("Credentials of store %s revealed to %s", store.ID, c.ClientIP())
+	models.RecordEvent(h.DB, store.ID, models.EventCredentialsViewed, models.ActorAPI, "credentials revealed", client)
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"store_id":    store.ID,
+		"credentials": creds,
+		"reveal_once": h.RevealCredentialsOnce,
+	})
+}
+
+// RotateCredentials starts replacing the passwords of a Ready store. The new
+// passwords are applied to the running store and its pods are restarted; the
+// returned operation tracks the rotation.
+func (h *StoreHandler) RotateCredentials(c *gin.Context) {
+	id := c.Param("id")
+	var store models.Store
+	if result := h.DB.First(&store, "id = ?", id); result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		} else {
+			log.Printf("Database error when fetching store %s: %v", id, result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if store.Status != models.StatusReady {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only Ready stores can rotate credentials, store is " + store.Status})
+		return
+	}
+	job, err := models.ActiveJob(h.DB, store.ID)
+	if err != nil {
+		log.Printf("Failed to find active job for store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if job != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Store has an operation in progress"})
+		return
+	}
+
+	operation, err := models.StartOperation(h.DB, store.ID, models.OperationRotateCredentials, models.JobRotateCredentials)
+	if err != nil {
+		log.Printf("Failed to start credential rotation for store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start credential rotation"})
+		return
+	}
+	models.RecordEvent(h.DB, store.ID, models.EventRotationRequested, models.ActorAPI, "credential rotation requested", fmt.Sprintf("client %s", c.ClientIP()))
+
+	h.Jobs.Wake()
+
+	c.Header("Location", operationLocation(operation))
+	c.JSON(http.StatusAccepted, gin.H{"message": "Credential rotation started", "operation": operation})
+}
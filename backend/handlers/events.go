@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"urumi-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultEventsLimit = 50
+	maxEventsLimit     = 200
+)
+
+// ListStoreEvents returns the store's timeline, newest first, paginated with ?page=&limit=.
+// Events outlive the store, so this also works for stores that were deleted.
+func (h *StoreHandler) ListStoreEvents(c *gin.Context) {
+	id := c.Param("id")
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive integer"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultEventsLimit)))
+	if err != nil || limit < 1 || limit > maxEventsLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxEventsLimit)})
+		return
+	}
+
+	var total int64
+	if err := h.DB.Model(&models.StoreEvent{}).Where("store_id = ?", id).Count(&total).Error; err != nil {
+		log.Printf("Database error when counting events for store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if total == 0 {
+		var count int64
+		h.DB.Model(&models.Store{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+			return
+		}
+	}
+
+	events := []models.StoreEvent{}
+	if err := h.DB.Where("store_id = ?", id).
+		Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&events).Error; err != nil {
+		log.Printf("Database error when fetching events for store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"page":   page,
+		"limit":  limit,
+		"total":  total,
+	})
+}
@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"urumi-backend/models"
+	"urumi-backend/orchestrator"
+	"urumi-backend/redact"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testEnv is the API wired to the job queue and reconciler on a simulated cluster
+type testEnv struct {
+	db      *gorm.DB
+	prov    *orchestrator.SimulatedProvisioner
+	handler *StoreHandler
+	router  *gin.Engine
+}
+
+// storeTypesOnce loads the shipped store-type catalog once; the workers of
+// earlier tests may still be reading it while they stop
+var (
+	storeTypesOnce sync.Once
+	storeTypesErr  error
+)
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	storeTypesOnce.Do(func() {
+		os.Setenv("STORE_TYPES_FILE", filepath.Join("..", "..", "charts", "store-types.yaml"))
+		storeTypesErr = orchestrator.ConfigureStoreTypesFromEnv()
+	})
+	if storeTypesErr != nil {
+		t.Fatal(storeTypesErr)
+	}
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "stores.db")+"?_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Store{}, &models.StoreEvent{}, &models.Job{}, &models.Operation{}, &models.StoreChange{}, &models.ProvisionAttempt{}, &models.ProvisionLogLine{}); err != nil {
+		t.Fatal(err)
+	}
+
+	prov := orchestrator.NewSimulatedProvisioner(orchestrator.SimulationConfig{
+		Latency: 20 * time.Millisecond,
+		Timeout: 50 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	jobs := orchestrator.NewJobQueue(db, prov, orchestrator.JobQueueConfig{
+		Workers: 2,
+		Retry:   orchestrator.RetryPolicy{MaxAttempts: 1},
+		Atomic:  true,
+	})
+	go jobs.Run(ctx)
+	go orchestrator.NewReconciler(db, prov, 100*time.Millisecond).Run(ctx)
+
+	gin.SetMode(gin.TestMode)
+	h := NewStoreHandler(db, prov, jobs)
+	r := gin.New()
+	api := r.Group("/api")
+	api.POST("/stores", h.CreateStore)
+	api.PUT("/stores/:id", h.UpdateStore)
+	api.DELETE("/stores/:id", h.DeleteStore)
+	api.POST("/stores/:id/retry", h.RetryStore)
+	api.POST("/stores/:id/cancel", h.CancelStore)
+	api.GET("/stores/:id/events", h.ListStoreEvents)
+	api.GET("/stores/:id/credentials", h.GetCredentials)
+	api.POST("/stores/:id/credentials/rotate", h.RotateCredentials)
+	api.GET("/stores/:id/revisions", h.ListRevisions)
+	api.POST("/stores/:id/rollback", h.RollbackStore)
+	api.GET("/operations/:id", h.GetOperation)
+	return &testEnv{db: db, prov: prov, handler: h, router: r}
+}
+
+// do sends a request to the API and decodes the JSON response into out, if given
+func (e *testEnv) do(t *testing.T, method, path string, body interface{}, out interface{}) int {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, path, w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+// createStore creates a store through the API and returns it with its operation
+func (e *testEnv) createStore(t *testing.T, storeType string) storeWithOperation {
+	t.Helper()
+	var created storeWithOperation
+	if code := e.do(t, http.MethodPost, "/api/stores", gin.H{"name": "Test Shop", "type": storeType}, &created); code != http.StatusAccepted {
+		t.Fatalf("create store: status %d", code)
+	}
+	return created
+}
+
+// createReadyStore creates a store and waits until its install finished and it is Ready
+func (e *testEnv) createReadyStore(t *testing.T, storeType string) models.Store {
+	t.Helper()
+	created := e.createStore(t, storeType)
+	if operation := e.waitForOperation(t, created.Operation.ID); operation.State != models.JobSucceeded {
+		t.Fatalf("create operation is %s: %s", operation.State, operation.Error)
+	}
+	return e.waitForStatus(t, created.ID, models.StatusReady)
+}
+
+// waitForStatus waits until the store has the given status and returns it
+func (e *testEnv) waitForStatus(t *testing.T, id, status string) models.Store {
+	t.Helper()
+	var store models.Store
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if err := e.db.First(&store, "id = ?", id).Error; err == nil && store.Status == status {
+			return store
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("store %s is %s (%s), want %s", id, store.Status, store.StatusReason, status)
+	return store
+}
+
+// countEvents returns how many events of the given type the store recorded
+func (e *testEnv) countEvents(t *testing.T, id, eventType string) int64 {
+	t.Helper()
+	var count int64
+	if err := e.db.Model(&models.StoreEvent{}).Where("store_id = ? AND type = ?", id, eventType).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// waitForOperation waits until the operation finished and returns it
+func (e *testEnv) waitForOperation(t *testing.T, id string) models.Operation {
+	t.Helper()
+	var operation models.Operation
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if code := e.do(t, http.MethodGet, "/api/operations/"+id, nil, &operation); code == http.StatusOK && operation.FinishedAt != nil {
+			return operation
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("operation %s is still %s", id, operation.State)
+	return operation
+}
+
+func TestStoreLifecycle(t *testing.T) {
+	e := newTestEnv(t)
+
+	created := e.createStore(t, "woocommerce")
+	if created.Status != models.StatusProvisioning || created.Plan != "" {
+		t.Fatalf("new store is %s with plan %q, want %s without a plan", created.Status, created.Plan, models.StatusProvisioning)
+	}
+	if operation := e.waitForOperation(t, created.Operation.ID); operation.State != models.JobSucceeded {
+		t.Fatalf("create operation is %s: %s", operation.State, operation.Error)
+	}
+	store := e.waitForStatus(t, created.ID, models.StatusReady)
+	creds, err := e.prov.Credentials(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redact.String(creds.AdminPassword) != redact.Mask {
+		t.Fatal("the store's admin password is not redacted")
+	}
+
+	var deleted struct {
+		Operation models.Operation `json:"operation"`
+	}
+	if code := e.do(t, http.MethodDelete, "/api/stores/"+store.ID, nil, &deleted); code != http.StatusOK {
+		t.Fatalf("delete store: status %d", code)
+	}
+	if operation := e.waitForOperation(t, deleted.Operation.ID); operation.State != models.JobSucceeded {
+		t.Fatalf("delete operation is %s: %s", operation.State, operation.Error)
+	}
+	if err := e.db.First(&models.Store{}, "id = ?", store.ID).Error; err != gorm.ErrRecordNotFound {
+		t.Fatalf("store record still exists after deletion: %v", err)
+	}
+	for _, eventType := range []string{models.EventDeletionRequested, models.EventStoreDeleted} {
+		var count int64
+		e.db.Model(&models.StoreEvent{}).Where("store_id = ? AND type = ?", store.ID, eventType).Count(&count)
+		if count != 1 {
+			t.Fatalf("recorded %d %s events, want 1", count, eventType)
+		}
+	}
+	status, err := e.prov.Status(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.NamespaceExists || status.Release != "" {
+		t.Fatalf("namespace %s or its release survived the deletion", store.Namespace)
+	}
+	// The passwords of a deleted store no longer need masking
+	if redact.String(creds.AdminPassword) != creds.AdminPassword {
+		t.Fatal("the deleted store's admin password is still redacted")
+	}
+}
+
+func TestStoreInstallFailureAndRetry(t *testing.T) {
+	e := newTestEnv(t)
+	store := e.createStore(t, "woocommerce").Store
+	e.waitForStatus(t, store.ID, models.StatusReady)
+
+	// Drift: the namespace disappears behind the orchestrator's back
+	e.prov.DeleteNamespace(store.Namespace)
+	e.waitForStatus(t, store.ID, models.StatusLost)
+
+	// Reinstalling hits a quota problem, which is not retried automatically
+	e.prov.InjectFailure(store.Namespace, orchestrator.SimFailureQuota)
+	var retried storeWithOperation
+	if code := e.do(t, http.MethodPost, "/api/stores/"+store.ID+"/retry", nil, &retried); code != http.StatusAccepted {
+		t.Fatalf("retry store: status %d", code)
+	}
+	operation := e.waitForOperation(t, retried.Operation.ID)
+	if operation.State != models.JobFailed || operation.ErrorCode != orchestrator.FailureQuotaExceeded {
+		t.Fatalf("retry operation is %s with %q, want %s with %s", operation.State, operation.ErrorCode, models.JobFailed, orchestrator.FailureQuotaExceeded)
+	}
+	failed := e.waitForStatus(t, store.ID, models.StatusFailed)
+	if failed.ErrorCode != orchestrator.FailureQuotaExceeded || failed.ErrorHint == "" {
+		t.Fatalf("failed store has error code %q and hint %q", failed.ErrorCode, failed.ErrorHint)
+	}
+
+	// The next retry goes through
+	if code := e.do(t, http.MethodPost, "/api/stores/"+store.ID+"/retry", nil, &retried); code != http.StatusAccepted {
+		t.Fatalf("second retry: status %d", code)
+	}
+	if operation := e.waitForOperation(t, retried.Operation.ID); operation.State != models.JobSucceeded {
+		t.Fatalf("second retry operation is %s: %s", operation.State, operation.Error)
+	}
+	if ready := e.waitForStatus(t, store.ID, models.StatusReady); ready.ErrorCode != "" {
+		t.Fatalf("ready store still has error code %q", ready.ErrorCode)
+	}
+}
+
+func TestStorePodDrift(t *testing.T) {
+	e := newTestEnv(t)
+	store := e.createStore(t, "medusa").Store
+	e.waitForStatus(t, store.ID, models.StatusReady)
+
+	e.prov.SetPodPhase(store.Namespace, "Pending")
+	e.waitForStatus(t, store.ID, models.StatusDegraded)
+
+	e.prov.SetPodPhase(store.Namespace, "Failed")
+	e.waitForStatus(t, store.ID, models.StatusFailed)
+
+	e.prov.SetPodPhase(store.Namespace, "Running")
+	e.waitForStatus(t, store.ID, models.StatusReady)
+}
+
+func TestCancelStore(t *testing.T) {
+	e := newTestEnv(t)
+	created := e.createStore(t, "woocommerce")
+
+	if code := e.do(t, http.MethodPost, "/api/stores/"+created.ID+"/cancel", nil, nil); code != http.StatusAccepted {
+		t.Fatalf("cancel store: status %d", code)
+	}
+	if operation := e.waitForOperation(t, created.Operation.ID); operation.State != models.JobCancelled {
+		t.Fatalf("create operation is %s, want %s", operation.State, models.JobCancelled)
+	}
+	e.waitForStatus(t, created.ID, models.StatusCancelled)
+
+	// There is nothing left to cancel
+	if code := e.do(t, http.MethodPost, "/api/stores/"+created.ID+"/cancel", nil, nil); code != http.StatusConflict {
+		t.Fatalf("second cancel: status %d, want %d", code, http.StatusConflict)
+	}
+}
+
+func TestCancelStoreTooLate(t *testing.T) {
+	e := newTestEnv(t)
+	created := e.createStore(t, "woocommerce")
+
+	// The cancellation lands while helm is finishing, too late to abort it
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		result := e.db.Model(&models.Job{}).
+			Where("operation_id = ? AND state = ?", created.Operation.ID, models.JobRunning).
+			Update("cancel_requested", true)
+		if result.Error != nil {
+			t.Fatal(result.Error)
+		}
+		if result.RowsAffected > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("install job never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	operation := e.waitForOperation(t, created.Operation.ID)
+	if operation.State != models.JobSucceeded || !strings.Contains(operation.Result, "before it could be cancelled") {
+		t.Fatalf("create operation is %s with result %q, want a ready store that was not cancelled", operation.State, operation.Result)
+	}
+	e.waitForStatus(t, created.ID, models.StatusReady)
+	var count int64
+	e.db.Model(&models.StoreEvent{}).Where("store_id = ? AND type = ?", created.ID, models.EventCancelTooLate).Count(&count)
+	if count != 1 {
+		t.Fatalf("recorded %d %s events, want 1", count, models.EventCancelTooLate)
+	}
+
+	// The finished install can no longer be cancelled
+	if code := e.do(t, http.MethodPost, "/api/stores/"+created.ID+"/cancel", nil, nil); code != http.StatusConflict {
+		t.Fatalf("cancel after install: status %d, want %d", code, http.StatusConflict)
+	}
+}
+
+func TestCreateStoreDryRun(t *testing.T) {
+	e := newTestEnv(t)
+	input := gin.H{"name": "Summer Shop", "type": "woocommerce"}
+
+	var first, second struct {
+		DryRun  bool                 `json:"dry_run"`
+		Store   models.Store         `json:"store"`
+		Preview orchestrator.Preview `json:"preview"`
+	}
+	if code := e.do(t, http.MethodPost, "/api/stores?dryRun=true", input, &first); code != http.StatusOK {
+		t.Fatalf("dry run: status %d", code)
+	}
+	if code := e.do(t, http.MethodPost, "/api/stores?dryRun=true", input, &second); code != http.StatusOK {
+		t.Fatalf("second dry run: status %d", code)
+	}
+	if !first.DryRun || first.Store.ID != previewStoreID || first.Store.Namespace != previewNamespace {
+		t.Fatalf("preview is for store %s in %s, want the placeholders", first.Store.ID, first.Store.Namespace)
+	}
+	// The same input renders the same manifest
+	if first.Preview.Manifest == "" || first.Preview.Manifest != second.Preview.Manifest {
+		t.Fatalf("previews differ:\n%s\n---\n%s", first.Preview.Manifest, second.Preview.Manifest)
+	}
+
+	var stores int64
+	e.db.Model(&models.Store{}).Count(&stores)
+	if stores != 0 {
+		t.Fatalf("dry run created %d stores", stores)
+	}
+}
+
+func TestStoreCredentialsRevealOnceAndRotate(t *testing.T) {
+	e := newTestEnv(t)
+	e.handler.RevealCredentialsOnce = true
+	store := e.createReadyStore(t, "woocommerce")
+
+	var revealed struct {
+		Credentials orchestrator.Credentials `json:"credentials"`
+		RevealOnce  bool                     `json:"reveal_once"`
+	}
+	path := "/api/stores/" + store.ID + "/credentials"
+	if code := e.do(t, http.MethodGet, path, nil, &revealed); code != http.StatusOK {
+		t.Fatalf("reveal credentials: status %d", code)
+	}
+	first := revealed.Credentials
+	if !revealed.RevealOnce || first.AdminPassword == "" || first.DatabasePassword == "" {
+		t.Fatalf("revealed %+v with reveal_once %v", first, revealed.RevealOnce)
+	}
+	if code := e.do(t, http.MethodGet, path, nil, nil); code != http.StatusGone {
+		t.Fatalf("second reveal: status %d, want %d", code, http.StatusGone)
+	}
+	// The refused reveal is audited too
+	if n := e.countEvents(t, store.ID, models.EventCredentialsViewed); n != 2 {
+		t.Fatalf("recorded %d %s events, want 2", n, models.EventCredentialsViewed)
+	}
+
+	var rotated struct {
+		Operation models.Operation `json:"operation"`
+	}
+	if code := e.do(t, http.MethodPost, path+"/rotate", nil, &rotated); code != http.StatusAccepted {
+		t.Fatalf("rotate credentials: status %d", code)
+	}
+	if operation := e.waitForOperation(t, rotated.Operation.ID); operation.State != models.JobSucceeded {
+		t.Fatalf("rotate operation is %s: %s", operation.State, operation.Error)
+	}
+	e.waitForStatus(t, store.ID, models.StatusReady)
+	for _, eventType := range []string{models.EventRotationRequested, models.EventRotated} {
+		if n := e.countEvents(t, store.ID, eventType); n != 1 {
+			t.Fatalf("recorded %d %s events, want 1", n, eventType)
+		}
+	}
+
+	// The rotation makes the new passwords revealable once more
+	if code := e.do(t, http.MethodGet, path, nil, &revealed); code != http.StatusOK {
+		t.Fatalf("reveal after rotation: status %d", code)
+	}
+	next := revealed.Credentials
+	if next.AdminUsername != first.AdminUsername {
+		t.Fatalf("rotation changed the admin username from %q to %q", first.AdminUsername, next.AdminUsername)
+	}
+	if next.AdminPassword == first.AdminPassword || next.DatabasePassword == first.DatabasePassword || next.DatabaseRootPassword == first.DatabaseRootPassword {
+		t.Fatal("rotation kept some of the old passwords")
+	}
+	if redact.String(first.AdminPassword) != first.AdminPassword || redact.String(next.AdminPassword) != redact.Mask {
+		t.Fatal("the rotated-out password is still redacted or the new one is not")
+	}
+	if code := e.do(t, http.MethodGet, path, nil, nil); code != http.StatusGone {
+		t.Fatalf("second reveal after rotation: status %d, want %d", code, http.StatusGone)
+	}
+}
+
+func TestRotateCredentialsRequiresReadyStore(t *testing.T) {
+	e := newTestEnv(t)
+	store := e.createStore(t, "woocommerce").Store
+
+	// Still provisioning
+	if code := e.do(t, http.MethodPost, "/api/stores/"+store.ID+"/credentials/rotate", nil, nil); code != http.StatusConflict {
+		t.Fatalf("rotate while provisioning: status %d, want %d", code, http.StatusConflict)
+	}
+	e.waitForStatus(t, store.ID, models.StatusReady)
+	if n := e.countEvents(t, store.ID, models.EventRotationRequested); n != 0 {
+		t.Fatalf("recorded %d %s events for a refused rotation", n, models.EventRotationRequested)
+	}
+}
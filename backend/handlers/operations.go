@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"urumi-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// storeWithOperation is the response of async calls that return the store,
+// with the operation to wait on next to the store's own fields
+type storeWithOperation struct {
+	models.Store
+	Operation *models.Operation `json:"operation"`
+}
+
+// operationLocation is where clients poll the operation
+func operationLocation(operation *models.Operation) string {
+	return "/api/operations/" + operation.ID
+}
+
+// GetOperation returns the progress of an async operation started by the API.
+// Operations outlive their store, so a finished delete can still be looked up.
+func (h *StoreHandler) GetOperation(c *gin.Context) {
+	id := c.Param("id")
+	operation, err := models.GetOperation(h.DB, id)
+	if err != nil {
+		log.Printf("Database error when fetching operation %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if operation == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Operation not found"})
+		return
+	}
+	c.JSON(http.StatusOK, operation)
+}
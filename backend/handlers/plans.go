@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"net/http"
+	"urumi-backend/orchestrator"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListPlans returns the size plans stores can be created with or moved to
+func (h *StoreHandler) ListPlans(c *gin.Context) {
+	plans, defaultPlan := orchestrator.Plans()
+	c.JSON(http.StatusOK, gin.H{"default": defaultPlan, "plans": plans})
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"urumi-backend/models"
+	"urumi-backend/redact"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Placeholders a create preview renders with instead of an ID and namespace
+// the store would never keep, so that previews of the same input are stable
+const (
+	previewStoreID   = "preview"
+	previewNamespace = "store-preview"
+)
+
+// dryRunRequested reads the dryRun query parameter, e.g. ?dryRun=true
+func dryRunRequested(c *gin.Context) (bool, error) {
+	return strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+}
+
+// respondWithPreview renders what installing or upgrading the store would
+// apply and returns it instead of applying it
+func (h *StoreHandler) respondWithPreview(c *gin.Context, store models.Store) {
+	preview, err := h.Provisioner.Render(c.Request.Context(), store)
+	if err != nil {
+		log.Printf("Failed to render preview of store %s: %v", store.ID, err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Failed to render store chart: " + redact.Error(err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dry_run": true, "store": store, "preview": preview})
+}
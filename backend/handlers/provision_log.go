@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"urumi-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StreamProvisionLog streams the store's install output line by line as
+// Server-Sent Events ("log" events carrying the line). It starts with the
+// latest attempt, or the one given by ?attempt=, and follows later attempts.
+// Reconnecting with the Last-Event-ID header resumes after that line.
+func (h *StoreHandler) StreamProvisionLog(c *gin.Context) {
+	id := c.Param("id")
+
+	// Subscribe before reading anything so no line slips through in between
+	notify, unsubscribe := models.SubscribeProvisionLogs()
+	defer unsubscribe()
+
+	var fromAttempt *models.ProvisionAttempt
+	var err error
+	attempt := "latest install attempt"
+	if v := c.Query("attempt"); v != "" {
+		attempt = "install attempt " + v
+		number, convErr := strconv.Atoi(v)
+		if convErr != nil || number < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "attempt must be a positive integer"})
+			return
+		}
+		fromAttempt, err = models.GetProvisionAttempt(h.DB, id, number)
+		if err == nil && fromAttempt == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Install attempt not found"})
+			return
+		}
+	} else {
+		fromAttempt, err = models.LatestProvisionAttempt(h.DB, id)
+	}
+	if err != nil {
+		log.Printf("Database error when fetching %s of store %s: %v", attempt, id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if fromAttempt == nil {
+		// Nothing was installed yet, the stream waits for the first attempt
+		var count int64
+		h.DB.Model(&models.Store{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+			return
+		}
+	}
+
+	var fromAttemptID uint
+	if fromAttempt != nil {
+		fromAttemptID = fromAttempt.ID
+	}
+	lastID, resume := lastEventID(c)
+	if resume {
+		// The client already has everything up to its last line
+		fromAttemptID = 0
+	}
+
+	startEventStream(c)
+	streamFeed(c, notify, lastID, func(afterID uint) ([]feedEvent, error) {
+		lines, err := models.ProvisionLogSince(h.DB, id, fromAttemptID, afterID, watchBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		events := make([]feedEvent, 0, len(lines))
+		for _, line := range lines {
+			data, err := json.Marshal(line)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode install log line %d: %w", line.ID, err)
+			}
+			events = append(events, feedEvent{ID: line.ID, Event: "log", Data: string(data)})
+		}
+		return events, nil
+	})
+}
+
+// ListProvisionAttempts returns the store's install attempts, oldest first
+func (h *StoreHandler) ListProvisionAttempts(c *gin.Context) {
+	id := c.Param("id")
+	attempts, err := models.ListProvisionAttempts(h.DB, id)
+	if err != nil {
+		log.Printf("Database error when listing install attempts of store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(attempts) == 0 {
+		var count int64
+		h.DB.Model(&models.Store{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"attempts": attempts})
+}
+
+// DownloadProvisionLog returns the full log of one install attempt as a text file
+func (h *StoreHandler) DownloadProvisionLog(c *gin.Context) {
+	id := c.Param("id")
+	number, err := strconv.Atoi(c.Param("attempt"))
+	if err != nil || number < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "attempt must be a positive integer"})
+		return
+	}
+
+	attempt, err := models.GetProvisionAttempt(h.DB, id, number)
+	if err != nil {
+		log.Printf("Database error when fetching install attempt %d of store %s: %v", number, id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if attempt == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Install attempt not found"})
+		return
+	}
+	lines, err := models.ProvisionLog(h.DB, attempt)
+	if err != nil {
+		log.Printf("Database error when reading the log of install attempt %d of store %s: %v", number, id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var out strings.Builder
+	for _, line := range lines {
+		fmt.Fprintf(&out, "%s %s\n", line.CreatedAt.Format(time.RFC3339), line.Text)
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-attempt-%d.log"`, id, number))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(out.String()))
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"urumi-backend/models"
+	"urumi-backend/orchestrator"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListRevisions returns the store's Helm release history, newest first
+func (h *StoreHandler) ListRevisions(c *gin.Context) {
+	id := c.Param("id")
+	var store models.Store
+	if result := h.DB.First(&store, "id = ?", id); result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		} else {
+			log.Printf("Database error when fetching store %s: %v", id, result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	revisions, err := h.Provisioner.Revisions(c.Request.Context(), store)
+	if errors.Is(err, orchestrator.ErrReleaseNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Store has no release"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to list revisions of store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read release history"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"store_id": store.ID, "revisions": revisions})
+}
+
+// RollbackStore starts rolling the store's release back to an earlier revision.
+// The store's desired spec is reset to that revision's, and the returned
+// operation succeeds once the rolled back store passes its health check.
+func (h *StoreHandler) RollbackStore(c *gin.Context) {
+	var input struct {
+		Revision int `json:"revision" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	var store models.Store
+	if result := h.DB.First(&store, "id = ?", id); result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		} else {
+			log.Printf("Database error when fetching store %s: %v", id, result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if store.Status != models.StatusReady && store.Status != models.StatusDegraded {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only Ready or Degraded stores can be rolled back, store is " + store.Status})
+		return
+	}
+	job, err := models.ActiveJob(h.DB, store.ID)
+	if err != nil {
+		log.Printf("Failed to find active job for store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if job != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Store has an operation in progress"})
+		return
+	}
+
+	revisions, err := h.Provisioner.Revisions(c.Request.Context(), store)
+	if err != nil && !errors.Is(err, orchestrator.ErrReleaseNotFound) {
+		log.Printf("Failed to list revisions of store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read release history"})
+		return
+	}
+	// The deployed revision is what runs now; a failed upgrade leaves a newer one that doesn't
+	var target, current *orchestrator.Revision
+	for i := range revisions {
+		if revisions[i].Revision == input.Revision {
+			target = &revisions[i]
+		}
+		if revisions[i].Status == "deployed" {
+			current = &revisions[i]
+		}
+	}
+	if target == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Store has no revision %d", input.Revision)})
+		return
+	}
+	if target == current {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Revision %d is the current revision", input.Revision)})
+		return
+	}
+	if target.Plan != "" {
+		if err := orchestrator.ValidatePlanChange(store.Plan, target.Plan); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot roll back to revision %d: %v", input.Revision, err)})
+			return
+		}
+	}
+
+	operation, err := models.StartRollback(h.DB, store.ID, input.Revision)
+	if err != nil {
+		log.Printf("Failed to start rollback of store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start rollback"})
+		return
+	}
+	running := "no deployed revision"
+	if current != nil {
+		running = fmt.Sprintf("current revision %d", current.Revision)
+	}
+	models.RecordEvent(h.DB, store.ID, models.EventReleaseRollbackRequested, models.ActorAPI,
+		fmt.Sprintf("rollback to revision %d requested", input.Revision),
+		fmt.Sprintf("%s; target chart %s, values %s", running, target.ChartVersion, target.ValuesDigest))
+
+	h.Jobs.Wake()
+
+	c.Header("Location", operationLocation(operation))
+	c.JSON(http.StatusAccepted, gin.H{"message": "Rollback started", "operation": operation})
+}
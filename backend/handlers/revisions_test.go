@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"urumi-backend/models"
+	"urumi-backend/orchestrator"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upgradeStore changes the store's spec through the API and waits for the upgrade
+func (e *testEnv) upgradeStore(t *testing.T, id string, spec gin.H) {
+	t.Helper()
+	var upgraded storeWithOperation
+	if code := e.do(t, http.MethodPut, "/api/stores/"+id, spec, &upgraded); code != http.StatusAccepted {
+		t.Fatalf("upgrade store with %v: status %d", spec, code)
+	}
+	if operation := e.waitForOperation(t, upgraded.Operation.ID); operation.State != models.JobSucceeded {
+		t.Fatalf("upgrade operation is %s: %s", operation.State, operation.Error)
+	}
+	e.waitForStatus(t, id, models.StatusReady)
+}
+
+// listRevisions returns the store's revisions as the API lists them
+func (e *testEnv) listRevisions(t *testing.T, id string) []orchestrator.Revision {
+	t.Helper()
+	var listed struct {
+		Revisions []orchestrator.Revision `json:"revisions"`
+	}
+	if code := e.do(t, http.MethodGet, "/api/stores/"+id+"/revisions", nil, &listed); code != http.StatusOK {
+		t.Fatalf("list revisions: status %d", code)
+	}
+	return listed.Revisions
+}
+
+func TestRollbackStoreRestoresSpec(t *testing.T) {
+	e := newTestEnv(t)
+	store := e.createReadyStore(t, "woocommerce")
+	e.upgradeStore(t, store.ID, gin.H{"plan": "small", "image_tag": "6.5", "values": gin.H{"wordpress.blogName": "Second"}})
+	e.upgradeStore(t, store.ID, gin.H{"image_tag": "6.6", "values": gin.H{"wordpress.blogName": "Third"}})
+
+	revisions := e.listRevisions(t, store.ID)
+	if len(revisions) != 3 {
+		t.Fatalf("store has %d revisions, want 3", len(revisions))
+	}
+	for i, want := range []struct {
+		revision int
+		status   string
+	}{{3, "deployed"}, {2, "superseded"}, {1, "superseded"}} {
+		if revisions[i].Revision != want.revision || revisions[i].Status != want.status {
+			t.Fatalf("revisions[%d] is %d %s, want %d %s", i, revisions[i].Revision, revisions[i].Status, want.revision, want.status)
+		}
+	}
+
+	path := "/api/stores/" + store.ID + "/rollback"
+	for _, revision := range []int{3, 9} {
+		if code := e.do(t, http.MethodPost, path, gin.H{"revision": revision}, nil); code != http.StatusBadRequest {
+			t.Fatalf("roll back to revision %d: status %d, want %d", revision, code, http.StatusBadRequest)
+		}
+	}
+
+	var rolledBack struct {
+		Operation models.Operation `json:"operation"`
+	}
+	if code := e.do(t, http.MethodPost, path, gin.H{"revision": 2}, &rolledBack); code != http.StatusAccepted {
+		t.Fatalf("roll back to revision 2: status %d", code)
+	}
+	if operation := e.waitForOperation(t, rolledBack.Operation.ID); operation.State != models.JobSucceeded {
+		t.Fatalf("rollback operation is %s: %s", operation.State, operation.Error)
+	}
+
+	// The store's desired spec is revision 2's again, so the next upgrade keeps it
+	restored := e.waitForStatus(t, store.ID, models.StatusReady)
+	if restored.Plan != "small" || restored.ImageTag != "6.5" || restored.Values["wordpress.blogName"] != "Second" {
+		t.Fatalf("store spec after the rollback is plan %q, image %q, values %v; want revision 2's", restored.Plan, restored.ImageTag, restored.Values)
+	}
+	if revisions := e.listRevisions(t, store.ID); len(revisions) != 4 || revisions[0].Status != "deployed" || revisions[0].ImageTag != "6.5" {
+		t.Fatalf("rollback did not deploy revision 2's spec as a new revision: %+v", revisions)
+	}
+	for _, eventType := range []string{models.EventReleaseRollbackRequested, models.EventReleaseRolledBack} {
+		if n := e.countEvents(t, store.ID, eventType); n != 1 {
+			t.Fatalf("recorded %d %s events, want 1", n, eventType)
+		}
+	}
+}
+
+// failedUpgradeProvisioner reports the newest revision of every release as a
+// failed upgrade, with the one before it still deployed
+type failedUpgradeProvisioner struct {
+	*orchestrator.SimulatedProvisioner
+}
+
+func (p failedUpgradeProvisioner) Revisions(ctx context.Context, store models.Store) ([]orchestrator.Revision, error) {
+	revisions, err := p.SimulatedProvisioner.Revisions(ctx, store)
+	if err != nil || len(revisions) < 2 {
+		return revisions, err
+	}
+	revisions[0].Status = "failed"
+	revisions[1].Status = "deployed"
+	return revisions, nil
+}
+
+func TestRollbackStoreAfterFailedUpgrade(t *testing.T) {
+	e := newTestEnv(t)
+	store := e.createReadyStore(t, "woocommerce")
+	e.upgradeStore(t, store.ID, gin.H{"image_tag": "6.5"})
+	e.handler.Provisioner = failedUpgradeProvisioner{e.prov}
+
+	// Revision 1 still runs, although revision 2 is newer
+	path := "/api/stores/" + store.ID + "/rollback"
+	if code := e.do(t, http.MethodPost, path, gin.H{"revision": 1}, nil); code != http.StatusBadRequest {
+		t.Fatalf("roll back to the deployed revision: status %d, want %d", code, http.StatusBadRequest)
+	}
+	var rolledBack struct {
+		Operation models.Operation `json:"operation"`
+	}
+	if code := e.do(t, http.MethodPost, path, gin.H{"revision": 2}, &rolledBack); code != http.StatusAccepted {
+		t.Fatalf("roll back to the failed revision: status %d, want %d", code, http.StatusAccepted)
+	}
+	e.waitForOperation(t, rolledBack.Operation.ID)
+	var requested models.StoreEvent
+	if err := e.db.First(&requested, "store_id = ? AND type = ?", store.ID, models.EventReleaseRollbackRequested).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(requested.Details, "current revision 1;") {
+		t.Fatalf("rollback request details %q don't name revision 1 as the current one", requested.Details)
+	}
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -9,6 +11,7 @@ import (
 	"time"
 	"urumi-backend/models"
 	"urumi-backend/orchestrator"
+	"urumi-backend/redact"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -16,11 +19,15 @@ import (
 )
 
 type StoreHandler struct {
-	DB *gorm.DB
+	DB          *gorm.DB
+	Provisioner orchestrator.Provisioner
+	Jobs        *orchestrator.JobQueue
+	// RevealCredentialsOnce lets GetCredentials reveal a store's credentials only once per rotation
+	RevealCredentialsOnce bool
 }
 
-func NewStoreHandler(db *gorm.DB) *StoreHandler {
-	return &StoreHandler{DB: db}
+func NewStoreHandler(db *gorm.DB, provisioner orchestrator.Provisioner, jobs *orchestrator.JobQueue) *StoreHandler {
+	return &StoreHandler{DB: db, Provisioner: provisioner, Jobs: jobs}
 }
 
 func (h *StoreHandler) ListStores(c *gin.Context) {
@@ -31,85 +38,111 @@ func (h *StoreHandler) ListStores(c *gin.Context) {
 
 func (h *StoreHandler) CreateStore(c *gin.Context) {
 	var input struct {
-		Name string `json:"name" binding:"required"`
-		Type string `json:"type" binding:"required"`
+		Name          string `json:"name" binding:"required"`
+		Type          string `json:"type" binding:"required"`
+		KeepOnFailure bool   `json:"keep_on_failure"` // Keep resources of a failed install for debugging
+		Plan          string `json:"plan"`            // Size plan; without one the chart's own sizes apply
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
 		return
 	}
+	dryRun, err := dryRunRequested(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dryRun must be true or false"})
+		return
+	}
 
 	// Validate store name
-	if len(strings.TrimSpace(input.Name)) < 2 || len(input.Name) > 50 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Store name must be between 2 and 50 characters"})
+	if err := validateStoreName(input.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Sanitize store name
-	nameRegex := regexp.MustCompile(`^[a-zA-Z0-9\s\-_]+$`)
-	if !nameRegex.MatchString(input.Name) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Store name can only contain letters, numbers, spaces, hyphens, and underscores"})
+	// Validate store type against the catalog
+	if _, err := orchestrator.LookupStoreType(input.Type); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Validate store type
-	if input.Type != "woocommerce" && input.Type != "medusa" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Store type must be either 'woocommerce' or 'medusa'"})
-		return
+	// Validate plan, if one was chosen
+	planName := strings.TrimSpace(input.Plan)
+	if planName != "" {
+		if _, err := orchestrator.LookupStorePlan(input.Type, planName); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
 	storeID := uuid.New().String()
 	namespace := "store-" + storeID[:8]
+	if dryRun {
+		storeID, namespace = previewStoreID, previewNamespace
+	}
 
 	domainSuffix := os.Getenv("DOMAIN_SUFFIX")
 	if domainSuffix == "" {
 		domainSuffix = "localhost"
 	}
 	store := models.Store{
-		ID:        storeID,
-		Name:      strings.TrimSpace(input.Name),
-		Type:      input.Type,
-		Status:    "Provisioning",
-		Namespace: namespace,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		URL:       "http://" + namespace + "." + domainSuffix,
+		ID:            storeID,
+		Name:          strings.TrimSpace(input.Name),
+		Type:          input.Type,
+		Plan:          planName,
+		Status:        models.StatusProvisioning,
+		StatusReason:  "store created",
+		KeepOnFailure: input.KeepOnFailure,
+		Version:       1,
+		Namespace:     namespace,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		URL:           "http://" + namespace + "." + domainSuffix,
 	}
 
-	if err := h.DB.Create(&store).Error; err != nil {
+	// Show what would be installed without creating anything
+	if dryRun {
+		h.respondWithPreview(c, store)
+		return
+	}
+
+	// Create the record and its install job together so a crash cannot leave one without the other
+	var operation *models.Operation
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&store).Error; err != nil {
+			return err
+		}
+		models.RecordStoreChange(tx, models.ChangeCreated, &store)
+		var err error
+		operation, err = models.StartOperation(tx, store.ID, models.OperationCreate, models.JobInstall)
+		return err
+	}); err != nil {
 		log.Printf("Failed to create store record: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create store record"})
 		return
 	}
+	models.RecordEvent(h.DB, store.ID, models.EventStoreCreated, models.ActorAPI, "store created", fmt.Sprintf("name=%s type=%s plan=%s namespace=%s", store.Name, store.Type, store.Plan, store.Namespace))
 
-	// Trigger async provisioning
-	go func(s models.Store) {
-		log.Printf("Starting provisioning for store %s (%s)", s.ID, s.Name)
-		err := orchestrator.ProvisionStore(s)
-		status := "Ready"
-		errorMessage := (*string)(nil)
-		if err != nil {
-			status = "Failed"
-			errStr := err.Error()
-			errorMessage = &errStr
-			log.Printf("Failed to provision store %s: %v", s.ID, err)
-		} else {
-			log.Printf("Successfully provisioned store %s", s.ID)
-		}
-		
-		updateErr := h.DB.Model(&s).Updates(map[string]interface{}{
-			"status":         status,
-			"error_message":  errorMessage,
-			"updated_at":     time.Now(),
-		}).Error
-		
-		if updateErr != nil {
-			log.Printf("Failed to update store status for %s: %v", s.ID, updateErr)
-		}
-	}(store)
+	// Provisioning runs on the job queue's worker pool
+	h.Jobs.Wake()
+
+	c.Header("Location", operationLocation(operation))
+	c.JSON(http.StatusAccepted, storeWithOperation{Store: store, Operation: operation})
+}
+
+// nameRegex matches the characters allowed in a store name
+var nameRegex = regexp.MustCompile(`^[a-zA-Z0-9\s\-_]+$`)
 
-	c.JSON(http.StatusAccepted, store)
+// validateStoreName checks the length and characters of a store name
+func validateStoreName(name string) error {
+	if len(strings.TrimSpace(name)) < 2 || len(name) > 50 {
+		return errors.New("Store name must be between 2 and 50 characters")
+	}
+	// Sanitize store name
+	if !nameRegex.MatchString(name) {
+		return errors.New("Store name can only contain letters, numbers, spaces, hyphens, and underscores")
+	}
+	return nil
 }
 
 func (h *StoreHandler) DeleteStore(c *gin.Context) {
@@ -126,41 +159,154 @@ func (h *StoreHandler) DeleteStore(c *gin.Context) {
 	}
 
 	// Check if store is already being deleted
-	if store.Status == "Deleting" {
+	if store.Status == models.StatusDeleting {
 		c.JSON(http.StatusConflict, gin.H{"error": "Store is already being deleted"})
 		return
 	}
 
-	// Mark as deleting immediately for UI feedback
-	if err := h.DB.Model(&store).Updates(map[string]interface{}{
-		"status":     "Deleting",
-		"updated_at": time.Now(),
-	}).Error; err != nil {
+	var operation *models.Operation
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// Mark as deleting immediately for UI feedback; Transition re-reads the
+		// store when the reconciler or a job wrote it in the meantime
+		updated, err := models.Transition(tx, store.ID, models.StatusDeleting, "deletion requested", models.ActorAPI, nil)
+		if err != nil {
+			return err
+		}
+		store = *updated
+		// Recorded with the transition, so a rejected deletion leaves no trace in the timeline
+		models.RecordEvent(tx, store.ID, models.EventDeletionRequested, models.ActorAPI, "deletion requested", "")
+		operation, err = models.StartOperation(tx, store.ID, models.OperationDelete, models.JobUninstall)
+		return err
+	}); err != nil {
+		if errors.Is(err, models.ErrInvalidTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Store changed state, please retry"})
+			return
+		}
 		log.Printf("Failed to mark store %s as deleting: %v", id, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update store status"})
 		return
 	}
 
-	// Trigger async deletion
-	go func(s models.Store) {
-		log.Printf("Starting deletion for store %s (%s)", s.ID, s.Name)
-		err := orchestrator.DeleteStore(s)
+	// Deletion runs on the job queue's worker pool
+	h.Jobs.Wake()
+
+	c.Header("Location", operationLocation(operation))
+	c.JSON(http.StatusOK, gin.H{"message": "Store deletion started", "operation": operation})
+}
+
+// RetryStore re-runs the install of a Failed, Lost or Cancelled store against the same namespace and URL
+func (h *StoreHandler) RetryStore(c *gin.Context) {
+	id := c.Param("id")
+	var store models.Store
+	if result := h.DB.First(&store, "id = ?", id); result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		} else {
+			log.Printf("Database error when fetching store %s: %v", id, result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	if !models.CanTransition(store.Status, models.StatusProvisioning) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only Failed, Lost or Cancelled stores can be retried, store is " + store.Status})
+		return
+	}
+
+	var operation *models.Operation
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		updated, err := models.Transition(tx, store.ID, models.StatusProvisioning, "retry requested", models.ActorAPI, map[string]interface{}{
+			"error_message": nil,
+			"error_code":    "",
+			"error_hint":    "",
+			"next_retry_at": nil,
+		})
 		if err != nil {
-			log.Printf("Failed to delete store %s: %v", s.ID, err)
-			// Mark as failed deletion
-			h.DB.Model(&s).Updates(map[string]interface{}{
-				"status":        "DeletionFailed",
-				"error_message": &[]string{err.Error()}[0],
-				"updated_at":    time.Now(),
-			})
+			return err
+		}
+		store = *updated
+		operation, err = models.StartOperation(tx, store.ID, models.OperationRetry, models.JobInstall)
+		return err
+	}); err != nil {
+		if errors.Is(err, models.ErrInvalidTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Store changed state, please retry"})
+			return
+		}
+		log.Printf("Failed to retry store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update store status"})
+		return
+	}
+	models.RecordEvent(h.DB, store.ID, models.EventRetryRequested, models.ActorAPI, "retry requested", fmt.Sprintf("after %d install attempts", store.ProvisionAttempts))
+
+	h.Jobs.Wake()
+
+	c.Header("Location", operationLocation(operation))
+	c.JSON(http.StatusAccepted, storeWithOperation{Store: store, Operation: operation})
+}
+
+// CancelStore aborts the store's in-flight install. The worker running it
+// removes the partial release and namespace and moves the store to Cancelled.
+func (h *StoreHandler) CancelStore(c *gin.Context) {
+	id := c.Param("id")
+	var store models.Store
+	if result := h.DB.First(&store, "id = ?", id); result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
 		} else {
-			log.Printf("Successfully deleted store %s", s.ID)
-			// Remove from database only after successful deletion
-			h.DB.Delete(&s)
+			log.Printf("Database error when fetching store %s: %v", id, result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		}
-	}(store)
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Store deletion started"})
+	if store.Status != models.StatusProvisioning {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only provisioning stores can be cancelled, store is " + store.Status})
+		return
+	}
+
+	job, err := models.ActiveJob(h.DB, store.ID)
+	if err != nil {
+		log.Printf("Failed to find install job for store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if job == nil || job.Type != models.JobInstall {
+		c.JSON(http.StatusConflict, gin.H{"error": "Store has no install in progress"})
+		return
+	}
+	if job.CancelRequested {
+		c.JSON(http.StatusConflict, gin.H{"error": "Store is already being cancelled"})
+		return
+	}
+
+	active, err := models.RequestJobCancel(h.DB, job)
+	if err != nil {
+		log.Printf("Failed to cancel install of store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel store"})
+		return
+	}
+	if !active {
+		c.JSON(http.StatusConflict, gin.H{"error": "Store install already finished"})
+		return
+	}
+	if _, err := models.UpdateLatest(h.DB, store.ID, models.StatusProvisioning, map[string]interface{}{
+		"status_reason": "cancellation requested",
+	}); err != nil {
+		log.Printf("Failed to update status reason for store %s: %v", id, err)
+	}
+	models.RecordEvent(h.DB, store.ID, models.EventCancelRequested, models.ActorAPI, "cancellation requested", fmt.Sprintf("job %d", job.ID))
+
+	// Abort the running helm operation, or wake a worker to roll back a job that is waiting
+	if !h.Jobs.Abort(job.ID) {
+		h.Jobs.Wake()
+	}
+
+	// The cancellation finishes the install's operation
+	operation, err := models.GetOperation(h.DB, job.OperationID)
+	if err != nil {
+		log.Printf("Failed to load operation of store %s: %v", id, err)
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Store cancellation started", "operation": operation})
 }
 
 func (h *StoreHandler) CheckStoreHealth(c *gin.Context) {
@@ -177,11 +323,11 @@ func (h *StoreHandler) CheckStoreHealth(c *gin.Context) {
 	}
 
 	// Perform health check
-	healthy, err := orchestrator.CheckStoreHealth(store)
+	healthy, err := h.Provisioner.CheckHealth(c.Request.Context(), store)
 	if err != nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"healthy": false,
-			"error":   err.Error(),
+			"error":   redact.Error(err),
 		})
 		return
 	}
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"net/http"
+	"urumi-backend/orchestrator"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListStoreTypes returns the store-type catalog: the types stores can be
+// created with, their readiness components and tunable parameters
+func (h *StoreHandler) ListStoreTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"types": orchestrator.StoreTypes()})
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"urumi-backend/models"
+	"urumi-backend/orchestrator"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UpdateStore changes the store's display name and its desired spec: the
+// image version, the size plan and the user-tunable chart values. A new name is saved right
+// away; a spec change is recorded and applied with a helm upgrade, tracked by
+// the returned operation. A null value resets a chart value to the chart default.
+// With ?dryRun=true nothing is saved; the response previews the upgrade instead.
+func (h *StoreHandler) UpdateStore(c *gin.Context) {
+	var input struct {
+		Name     *string                `json:"name"`
+		ImageTag *string                `json:"image_tag"`
+		Plan     *string                `json:"plan"`
+		Values   map[string]interface{} `json:"values"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	dryRun, err := dryRunRequested(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dryRun must be true or false"})
+		return
+	}
+
+	id := c.Param("id")
+	var store models.Store
+	if result := h.DB.First(&store, "id = ?", id); result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Store not found"})
+		} else {
+			log.Printf("Database error when fetching store %s: %v", id, result.Error)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	updates := make(map[string]interface{})
+	var changes []string
+	if input.Name != nil {
+		if err := validateStoreName(*input.Name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if name := strings.TrimSpace(*input.Name); name != store.Name {
+			updates["name"] = name
+			changes = append(changes, "name="+name)
+		}
+	}
+
+	upgrade := false
+	if input.ImageTag != nil {
+		tag := strings.TrimSpace(*input.ImageTag)
+		if tag != "" {
+			if err := orchestrator.ValidateImageTag(tag); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if tag != store.ImageTag {
+			updates["image_tag"] = tag
+			changes = append(changes, "image_tag="+tag)
+			upgrade = true
+		}
+	}
+	if input.Plan != nil {
+		plan, err := orchestrator.LookupStorePlan(store.Type, strings.TrimSpace(*input.Plan))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if plan.Name != store.Plan {
+			// Moving between plans resizes the store's volumes, which can only grow
+			if err := orchestrator.ValidatePlanChange(store.Plan, plan.Name); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			updates["plan"] = plan.Name
+			changes = append(changes, "plan="+plan.Name)
+			upgrade = true
+		}
+	}
+	if input.Values != nil {
+		if err := orchestrator.ValidateValues(store.Type, input.Values); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		values, changed := mergeValues(store.Values, input.Values)
+		if len(changed) > 0 {
+			updates["values"] = values
+			changes = append(changes, changed...)
+			upgrade = true
+		}
+	}
+
+	if dryRun {
+		desired := store
+		if tag, ok := updates["image_tag"].(string); ok {
+			desired.ImageTag = tag
+		}
+		if plan, ok := updates["plan"].(string); ok {
+			desired.Plan = plan
+		}
+		if values, ok := updates["values"].(models.ChartValues); ok {
+			desired.Values = values
+		}
+		if name, ok := updates["name"].(string); ok {
+			desired.Name = name
+		}
+		h.respondWithPreview(c, desired)
+		return
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusOK, store)
+		return
+	}
+
+	if !upgrade {
+		updated, err := models.UpdateSpec(h.DB, &store, updates)
+		if err != nil {
+			if errors.Is(err, models.ErrSpecChanged) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Store changed state, please retry"})
+				return
+			}
+			log.Printf("Failed to update store %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update store"})
+			return
+		}
+		models.RecordEvent(h.DB, store.ID, models.EventStoreUpdated, models.ActorAPI, "store updated", strings.Join(changes, " "))
+		c.JSON(http.StatusOK, updated)
+		return
+	}
+
+	// The spec is applied to the running release, so there has to be one
+	if store.Status != models.StatusReady && store.Status != models.StatusDegraded {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only Ready or Degraded stores can be upgraded, store is " + store.Status})
+		return
+	}
+	job, err := models.ActiveJob(h.DB, store.ID)
+	if err != nil {
+		log.Printf("Failed to find active job for store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if job != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Store has an operation in progress"})
+		return
+	}
+
+	// Record the desired spec and its upgrade job together, like CreateStore does
+	var operation *models.Operation
+	if err := h.DB.Transaction(func(tx *gorm.DB) error {
+		// The reconciler writes the store too; only a changed spec or status fails the update
+		updated, err := models.UpdateSpec(tx, &store, updates, models.StatusReady, models.StatusDegraded)
+		if err != nil {
+			return err
+		}
+		store = *updated
+		operation, err = models.StartOperation(tx, store.ID, models.OperationUpgrade, models.JobUpgrade)
+		return err
+	}); err != nil {
+		if errors.Is(err, models.ErrSpecChanged) || errors.Is(err, models.ErrInvalidTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Store changed state, please retry"})
+			return
+		}
+		log.Printf("Failed to start upgrade of store %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start store upgrade"})
+		return
+	}
+	models.RecordEvent(h.DB, store.ID, models.EventStoreUpdated, models.ActorAPI, "store spec updated, upgrade requested", strings.Join(changes, " "))
+
+	h.Jobs.Wake()
+
+	c.Header("Location", operationLocation(operation))
+	c.JSON(http.StatusAccepted, storeWithOperation{Store: store, Operation: operation})
+}
+
+// mergeValues applies a values update to the current values. A nil value
+// removes the key. It returns the merged values and the keys that changed.
+func mergeValues(current models.ChartValues, update map[string]interface{}) (models.ChartValues, []string) {
+	merged := make(models.ChartValues, len(current)+len(update))
+	for key, value := range current {
+		merged[key] = value
+	}
+
+	var changed []string
+	for key, value := range update {
+		existing, exists := merged[key]
+		switch {
+		case value == nil && exists:
+			delete(merged, key)
+			changed = append(changed, key+"=<default>")
+		case value == nil:
+		case !exists || !sameValue(existing, value):
+			merged[key] = value
+			changed = append(changed, fmt.Sprintf("%s=%v", key, value))
+		}
+	}
+	sort.Strings(changed)
+	return merged, changed
+}
+
+// sameValue reports whether two chart values are equal. Numbers are compared by
+// value, since those read back from the database are float64 and validated
+// integers are int64.
+func sameValue(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// number returns a numeric chart value as a float64
+func number(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
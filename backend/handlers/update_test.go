@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"urumi-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMergeValuesComparesNumbersByValue(t *testing.T) {
+	// What the database gives back next to what ValidateValues makes of the update
+	current := models.ChartValues{"replicaCount": float64(1000000), "wordpress.blogName": "Shop"}
+	update := map[string]interface{}{"replicaCount": int64(1000000), "wordpress.blogName": "Shop"}
+
+	merged, changed := mergeValues(current, update)
+	if len(changed) != 0 {
+		t.Fatalf("unchanged values reported as changed: %v", changed)
+	}
+	if merged["replicaCount"] != float64(1000000) {
+		t.Fatalf("merged replicaCount is %v", merged["replicaCount"])
+	}
+
+	_, changed = mergeValues(current, map[string]interface{}{"replicaCount": int64(2), "wordpress.blogName": nil})
+	if len(changed) != 2 || changed[0] != "replicaCount=2" || changed[1] != "wordpress.blogName=<default>" {
+		t.Fatalf("changed = %v, want the new count and the reset title", changed)
+	}
+}
+
+func TestUpdateStoreNameOnly(t *testing.T) {
+	e := newTestEnv(t)
+	store := e.createReadyStore(t, "woocommerce")
+
+	var updated models.Store
+	if code := e.do(t, http.MethodPut, "/api/stores/"+store.ID, gin.H{"name": "Renamed Shop"}, &updated); code != http.StatusOK {
+		t.Fatalf("rename store: status %d", code)
+	}
+	if updated.Name != "Renamed Shop" {
+		t.Fatalf("store is named %q after the rename", updated.Name)
+	}
+	// A new name is saved without an upgrade
+	var jobs int64
+	e.db.Model(&models.Job{}).Where("store_id = ? AND type = ?", store.ID, models.JobUpgrade).Count(&jobs)
+	if jobs != 0 {
+		t.Fatalf("renaming the store queued %d upgrades", jobs)
+	}
+	if n := e.countEvents(t, store.ID, models.EventStoreUpdated); n != 1 {
+		t.Fatalf("recorded %d %s events, want 1", n, models.EventStoreUpdated)
+	}
+}
+
+func TestUpdateStoreSpec(t *testing.T) {
+	e := newTestEnv(t)
+	store := e.createReadyStore(t, "medusa")
+	path := "/api/stores/" + store.ID
+
+	var upgraded storeWithOperation
+	if code := e.do(t, http.MethodPut, path, gin.H{"values": gin.H{"replicaCount": 2}}, &upgraded); code != http.StatusAccepted {
+		t.Fatalf("set replicaCount: status %d", code)
+	}
+	if operation := e.waitForOperation(t, upgraded.Operation.ID); operation.State != models.JobSucceeded {
+		t.Fatalf("upgrade operation is %s: %s", operation.State, operation.Error)
+	}
+	e.waitForStatus(t, store.ID, models.StatusReady)
+
+	// The same value again is no change, although the saved one reads back as a float
+	var unchanged models.Store
+	if code := e.do(t, http.MethodPut, path, gin.H{"values": gin.H{"replicaCount": 2}}, &unchanged); code != http.StatusOK {
+		t.Fatalf("repeat replicaCount: status %d, want %d", code, http.StatusOK)
+	}
+
+	// null resets the value to the chart default
+	var reset storeWithOperation
+	if code := e.do(t, http.MethodPut, path, gin.H{"values": gin.H{"replicaCount": nil}}, &reset); code != http.StatusAccepted {
+		t.Fatalf("reset replicaCount: status %d", code)
+	}
+	if _, ok := reset.Values["replicaCount"]; ok {
+		t.Fatalf("replicaCount is still set after the reset: %v", reset.Values)
+	}
+	if operation := e.waitForOperation(t, reset.Operation.ID); operation.State != models.JobSucceeded {
+		t.Fatalf("reset operation is %s: %s", operation.State, operation.Error)
+	}
+}
+
+func TestUpdateStoreRejectsPlanDowngrade(t *testing.T) {
+	e := newTestEnv(t)
+	store := e.createReadyStore(t, "woocommerce")
+	path := "/api/stores/" + store.ID
+
+	var upgraded storeWithOperation
+	if code := e.do(t, http.MethodPut, path, gin.H{"plan": "medium"}, &upgraded); code != http.StatusAccepted {
+		t.Fatalf("move to plan medium: status %d", code)
+	}
+	if operation := e.waitForOperation(t, upgraded.Operation.ID); operation.State != models.JobSucceeded {
+		t.Fatalf("upgrade operation is %s: %s", operation.State, operation.Error)
+	}
+	e.waitForStatus(t, store.ID, models.StatusReady)
+
+	// small has smaller volumes than medium, and volumes cannot shrink
+	if code := e.do(t, http.MethodPut, path, gin.H{"plan": "small"}, nil); code != http.StatusBadRequest {
+		t.Fatalf("move to plan small: status %d, want %d", code, http.StatusBadRequest)
+	}
+	var current models.Store
+	if err := e.db.First(&current, "id = ?", store.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if current.Plan != "medium" {
+		t.Fatalf("store has plan %q after the refused downgrade, want medium", current.Plan)
+	}
+}
+
+func TestUpdateStoreSpecRequiresRunningStore(t *testing.T) {
+	e := newTestEnv(t)
+	created := e.createStore(t, "woocommerce")
+	if code := e.do(t, http.MethodPost, "/api/stores/"+created.ID+"/cancel", nil, nil); code != http.StatusAccepted {
+		t.Fatalf("cancel store: status %d", code)
+	}
+	e.waitForStatus(t, created.ID, models.StatusCancelled)
+
+	if code := e.do(t, http.MethodPut, "/api/stores/"+created.ID, gin.H{"image_tag": "6.5"}, nil); code != http.StatusConflict {
+		t.Fatalf("upgrade a cancelled store: status %d, want %d", code, http.StatusConflict)
+	}
+	// Renaming needs no release
+	if code := e.do(t, http.MethodPut, "/api/stores/"+created.ID, gin.H{"name": "Renamed Shop"}, nil); code != http.StatusOK {
+		t.Fatalf("rename a cancelled store: status %d", code)
+	}
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"urumi-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// watchPollInterval catches changes committed after their notification fired
+	watchPollInterval = time.Second
+	// watchHeartbeatInterval keeps idle streams open through proxies
+	watchHeartbeatInterval = 15 * time.Second
+	// watchBatchSize is how many changes are read from the feed at a time
+	watchBatchSize = 100
+	// storeChangeRetention is how long a disconnected watcher can resume without a new snapshot
+	storeChangeRetention = time.Hour
+	// provisionAttemptsKept is how many of a store's latest install attempts keep their log
+	provisionAttemptsKept = 10
+)
+
+// WatchStores streams store changes as Server-Sent Events. A new client first
+// gets a "snapshot" event with every store, then a "created", "updated" or
+// "deleted" event carrying the store each time one is written. Reconnecting
+// with the Last-Event-ID header resumes after that event; if it is too old the
+// stream starts over with a snapshot.
+func (h *StoreHandler) WatchStores(c *gin.Context) {
+	lastID, resume := lastEventID(c)
+
+	// Subscribe before reading anything so no change slips through in between
+	notify, unsubscribe := models.SubscribeStoreChanges()
+	defer unsubscribe()
+
+	oldest, newest, err := models.StoreChangeBounds(h.DB)
+	if err != nil {
+		log.Printf("%v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var stores []models.Store
+	snapshot := !resume || lastID > newest || (oldest > 0 && lastID+1 < oldest)
+	if snapshot {
+		// Changes recorded while listing are streamed again afterwards, which is harmless
+		if err := h.DB.Find(&stores).Error; err != nil {
+			log.Printf("Database error when listing stores for watch: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		lastID = newest
+	}
+
+	startEventStream(c)
+	if snapshot {
+		data, err := json.Marshal(stores)
+		if err != nil {
+			log.Printf("Failed to encode store snapshot: %v", err)
+			return
+		}
+		if err := writeEvent(c.Writer, strconv.FormatUint(uint64(lastID), 10), "snapshot", string(data)); err != nil {
+			return
+		}
+	}
+
+	streamFeed(c, notify, lastID, func(afterID uint) ([]feedEvent, error) {
+		changes, err := models.StoreChangesSince(h.DB, afterID, watchBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		events := make([]feedEvent, len(changes))
+		for i, change := range changes {
+			events[i] = feedEvent{ID: change.ID, Event: change.Type, Data: change.Store}
+		}
+		return events, nil
+	})
+}
+
+// feedEvent is one Server-Sent Event read from a persisted feed
+type feedEvent struct {
+	ID    uint
+	Event string
+	Data  string
+}
+
+// streamFeed writes the events that next returns after lastID, then waits for
+// more until the client goes away. next is called again whenever notify fires
+// and every watchPollInterval, which catches rows committed after their
+// notification. It must return at most watchBatchSize events.
+func streamFeed(c *gin.Context, notify <-chan struct{}, lastID uint, next func(afterID uint) ([]feedEvent, error)) {
+	c.Writer.Flush()
+
+	poll := time.NewTicker(watchPollInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(watchHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		events, err := next(lastID)
+		if err != nil {
+			log.Printf("%v", err)
+			return
+		}
+		for _, event := range events {
+			if err := writeEvent(c.Writer, strconv.FormatUint(uint64(event.ID), 10), event.Event, event.Data); err != nil {
+				return
+			}
+			lastID = event.ID
+		}
+		c.Writer.Flush()
+		if len(events) == watchBatchSize {
+			continue
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-notify:
+		case <-poll.C:
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer, ": keepalive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// PruneHistory periodically drops store changes older than storeChangeRetention,
+// and the install logs of deleted stores and of all but a store's latest
+// provisionAttemptsKept attempts
+func (h *StoreHandler) PruneHistory() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := models.PruneStoreChanges(h.DB, time.Now().Add(-storeChangeRetention)); err != nil {
+			log.Printf("Failed to prune the store change feed: %v", err)
+		}
+		if _, err := models.PruneProvisionLogs(h.DB, provisionAttemptsKept); err != nil {
+			log.Printf("Failed to prune install logs: %v", err)
+		}
+	}
+}
+
+// lastEventID reads the ID of the last event a reconnecting client received
+func lastEventID(c *gin.Context) (uint, bool) {
+	header := c.GetHeader("Last-Event-ID")
+	if header == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(header, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// startEventStream sends the headers of a Server-Sent Events response
+func startEventStream(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Stop nginx from buffering the stream
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+}
+
+// writeEvent writes one Server-Sent Event; data must not contain newlines
+func writeEvent(w io.Writer, id, event, data string) error {
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, event, data)
+	return err
+}
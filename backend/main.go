@@ -1,14 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 	"urumi-backend/handlers"
 	"urumi-backend/middleware"
 	"urumi-backend/models"
 	"urumi-backend/orchestrator"
+	"urumi-backend/redact"
 
 	"github.com/gin-gonic/gin"
 	"github.com/glebarez/sqlite"
@@ -16,17 +20,51 @@ import (
 )
 
 func main() {
-	// Initialize Database
-	db, err := gorm.Open(sqlite.Open("stores.db"), &gorm.Config{})
+	// Mask credentials in everything the backend logs
+	log.SetOutput(redact.NewWriter(os.Stderr))
+
+	// Initialize Database. Transactions take the write lock when they begin, so
+	// those that re-read a store before writing it wait for other writers
+	// instead of failing with "database is locked".
+	db, err := gorm.Open(sqlite.Open("stores.db?_txlock=immediate&_pragma=busy_timeout(5000)"), &gorm.Config{})
 	if err != nil {
 		log.Fatal("failed to connect database")
 	}
 
 	// Migrate the schema
-	db.AutoMigrate(&models.Store{})
+	db.AutoMigrate(&models.Store{}, &models.StoreEvent{}, &models.Job{}, &models.Operation{}, &models.StoreChange{}, &models.ProvisionAttempt{}, &models.ProvisionLogLine{})
+
+	// Load the store types and size plans stores can be created with
+	if err := orchestrator.ConfigureStoreTypesFromEnv(); err != nil {
+		log.Fatalf("failed to load store types: %v", err)
+	}
+	if err := orchestrator.ConfigurePlansFromEnv(); err != nil {
+		log.Fatalf("failed to load store plans: %v", err)
+	}
+
+	// Pick the cluster driver (helm or simulated)
+	provisioner, err := orchestrator.NewProvisionerFromEnv()
+	if err != nil {
+		log.Fatalf("failed to initialise provisioner: %v", err)
+	}
+
+	// Start background reconciliation: cluster watch events plus a periodic full resync
+	resync := 5 * time.Minute
+	if v := os.Getenv("RECONCILE_RESYNC_INTERVAL"); v != "" {
+		if resync, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("invalid RECONCILE_RESYNC_INTERVAL %q: %v", v, err)
+		}
+	}
+	reconciler := orchestrator.NewReconciler(db, provisioner, resync)
+	go reconciler.Run(context.Background())
 
-	// Start background reconciliation
-	go startReconciliationService(db)
+	// Start the provisioning workers; jobs interrupted by a restart are picked up again
+	jobConfig, err := orchestrator.JobQueueConfigFromEnv()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	jobs := orchestrator.NewJobQueue(db, provisioner, jobConfig)
+	go jobs.Run(context.Background())
 
 	// Initialize rate limiter (20 requests per minute, burst of 40) - increased for demo
 	rateLimiter := middleware.NewRateLimiter(20, 40)
@@ -39,7 +77,7 @@ func main() {
 
 	// Add security middlewares
 	r.Use(middleware.SecurityHeaders())
-	r.Use(middleware.TimeoutMiddleware(30 * time.Second))
+	r.Use(middleware.TimeoutMiddleware(30*time.Second, "/api/stores/watch", "/api/stores/:id/provision-log"))
 	r.Use(middleware.ValidateContentType())
 	r.Use(gin.Recovery())
 
@@ -63,14 +101,35 @@ func main() {
 	}))
 
 	// Handlers
-	storeHandler := handlers.NewStoreHandler(db)
+	storeHandler := handlers.NewStoreHandler(db, provisioner, jobs)
+	if v := os.Getenv("CREDENTIALS_REVEAL_ONCE"); v != "" {
+		if storeHandler.RevealCredentialsOnce, err = strconv.ParseBool(v); err != nil {
+			log.Fatalf("invalid CREDENTIALS_REVEAL_ONCE %q: %v", v, err)
+		}
+	}
+	go storeHandler.PruneHistory()
 
 	api := r.Group("/api")
 	{
 		api.GET("/stores", storeHandler.ListStores)
+		api.GET("/stores/watch", storeHandler.WatchStores)
 		api.POST("/stores", storeHandler.CreateStore)
+		api.PUT("/stores/:id", storeHandler.UpdateStore)
 		api.DELETE("/stores/:id", storeHandler.DeleteStore)
+		api.POST("/stores/:id/retry", storeHandler.RetryStore)
+		api.POST("/stores/:id/cancel", storeHandler.CancelStore)
 		api.GET("/stores/:id/health", storeHandler.CheckStoreHealth)
+		api.GET("/stores/:id/events", storeHandler.ListStoreEvents)
+		api.GET("/stores/:id/provision-log", storeHandler.StreamProvisionLog)
+		api.GET("/stores/:id/provision-attempts", storeHandler.ListProvisionAttempts)
+		api.GET("/stores/:id/provision-attempts/:attempt/log", storeHandler.DownloadProvisionLog)
+		api.GET("/stores/:id/credentials", storeHandler.GetCredentials)
+		api.POST("/stores/:id/credentials/rotate", storeHandler.RotateCredentials)
+		api.GET("/stores/:id/revisions", storeHandler.ListRevisions)
+		api.POST("/stores/:id/rollback", storeHandler.RollbackStore)
+		api.GET("/operations/:id", storeHandler.GetOperation)
+		api.GET("/plans", storeHandler.ListPlans)
+		api.GET("/store-types", storeHandler.ListStoreTypes)
 	}
 
 	// Health check endpoint
@@ -86,31 +145,3 @@ func main() {
 	log.Println("Security features enabled: CORS, Rate Limiting, Security Headers")
 	r.Run(":8080")
 }
-
-// startReconciliationService runs background checks to ensure store status is accurate
-func startReconciliationService(db *gorm.DB) {
-	ticker := time.NewTicker(30 * time.Second) // Check every 30 seconds
-	defer ticker.Stop()
-
-	log.Println("Starting store reconciliation service")
-
-	for range ticker.C {
-		var stores []models.Store
-		if err := db.Find(&stores).Error; err != nil {
-			log.Printf("Failed to fetch stores for reconciliation: %v", err)
-			continue
-		}
-
-		for _, store := range stores {
-			// Skip stores that are being deleted
-			if store.Status == "Deleting" || store.Status == "DeletionFailed" {
-				continue
-			}
-
-			// Reconcile store status
-			if err := orchestrator.ReconcileStoreStatus(store, db); err != nil {
-				log.Printf("Failed to reconcile store %s: %v", store.ID, err)
-			}
-		}
-	}
-}
@@ -13,38 +13,38 @@ func SecurityHeaders() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Prevent clickjacking
 		c.Writer.Header().Set("X-Frame-Options", "DENY")
-		
+
 		// Prevent MIME type sniffing
 		c.Writer.Header().Set("X-Content-Type-Options", "nosniff")
-		
+
 		// Enable XSS protection
 		c.Writer.Header().Set("X-XSS-Protection", "1; mode=block")
-		
+
 		// Content Security Policy
-		c.Writer.Header().Set("Content-Security-Policy", 
+		c.Writer.Header().Set("Content-Security-Policy",
 			"default-src 'self'; "+
-			"script-src 'self' 'unsafe-inline' 'unsafe-eval'; "+
-			"style-src 'self' 'unsafe-inline'; "+
-			"img-src 'self' data: https:; "+
-			"font-src 'self'; "+
-			"connect-src 'self' ws: wss:; "+
-			"frame-ancestors 'none'; "+
-			"base-uri 'self'; "+
-			"form-action 'self'")
-		
+				"script-src 'self' 'unsafe-inline' 'unsafe-eval'; "+
+				"style-src 'self' 'unsafe-inline'; "+
+				"img-src 'self' data: https:; "+
+				"font-src 'self'; "+
+				"connect-src 'self' ws: wss:; "+
+				"frame-ancestors 'none'; "+
+				"base-uri 'self'; "+
+				"form-action 'self'")
+
 		// Referrer Policy
 		c.Writer.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
-		
+
 		// Permissions Policy (formerly Feature Policy)
-		c.Writer.Header().Set("Permissions-Policy", 
+		c.Writer.Header().Set("Permissions-Policy",
 			"geolocation=(), microphone=(), camera=(), payment=(), usb=()")
-		
+
 		// Strict Transport Security (only for HTTPS)
 		if c.Request.TLS != nil {
-			c.Writer.Header().Set("Strict-Transport-Security", 
+			c.Writer.Header().Set("Strict-Transport-Security",
 				"max-age=31536000; includeSubDomains; preload")
 		}
-		
+
 		c.Next()
 	}
 }
@@ -65,21 +65,31 @@ func RequestSizeLimit(maxSize int64) gin.HandlerFunc {
 	})
 }
 
-// TimeoutMiddleware adds a timeout to requests
-func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+// TimeoutMiddleware adds a timeout to requests. Long-lived streams such as
+// Server-Sent Events are exempted by their route path.
+func TimeoutMiddleware(timeout time.Duration, streamingPaths ...string) gin.HandlerFunc {
+	streaming := make(map[string]bool, len(streamingPaths))
+	for _, path := range streamingPaths {
+		streaming[path] = true
+	}
 	return func(c *gin.Context) {
+		if streaming[c.FullPath()] {
+			c.Next()
+			return
+		}
+
 		// Create a context with timeout
 		ctx, cancel := c.Request.Context(), func() {}
-		
+
 		// Use gin's built-in timeout
 		c.Request = c.Request.WithContext(ctx)
-		
+
 		finished := make(chan struct{})
 		go func() {
 			c.Next()
 			finished <- struct{}{}
 		}()
-		
+
 		select {
 		case <-finished:
 			return
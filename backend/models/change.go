@@ -0,0 +1,90 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Store change types
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// StoreChange is one entry of the store change feed that watchers stream from.
+// Its ID increases monotonically and is used as the SSE event ID, so a client
+// can resume after a disconnect without missing changes.
+type StoreChange struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	StoreID   string    `json:"store_id" gorm:"index"`
+	Type      string    `json:"type"`  // created, updated or deleted
+	Store     string    `json:"store"` // JSON snapshot of the store after the change
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// storeChanges wakes up watchers whenever a change is recorded
+var storeChanges notifier
+
+// RecordStoreChange appends the store's current state to the change feed.
+// Like RecordEvent it only logs failures, so the feed never blocks a store write.
+func RecordStoreChange(db *gorm.DB, changeType string, store *Store) {
+	snapshot, err := json.Marshal(store)
+	if err != nil {
+		log.Printf("Failed to encode %s change for store %s: %v", changeType, store.ID, err)
+		return
+	}
+	change := StoreChange{
+		StoreID:   store.ID,
+		Type:      changeType,
+		Store:     string(snapshot),
+		CreatedAt: time.Now(),
+	}
+	if err := db.Create(&change).Error; err != nil {
+		log.Printf("Failed to record %s change for store %s: %v", changeType, store.ID, err)
+		return
+	}
+	storeChanges.notify()
+}
+
+// SubscribeStoreChanges returns a channel that receives a signal after changes
+// are recorded, and a function that unsubscribes it. Signals are coalesced, so
+// subscribers must read the feed with StoreChangesSince rather than count them.
+func SubscribeStoreChanges() (<-chan struct{}, func()) {
+	return storeChanges.subscribe()
+}
+
+// StoreChangesSince returns up to limit changes recorded after the given change ID, oldest first
+func StoreChangesSince(db *gorm.DB, afterID uint, limit int) ([]StoreChange, error) {
+	var changes []StoreChange
+	if err := db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to read store changes after %d: %w", afterID, err)
+	}
+	return changes, nil
+}
+
+// StoreChangeBounds returns the IDs of the oldest and newest retained changes, 0 if there are none
+func StoreChangeBounds(db *gorm.DB) (oldest, newest uint, err error) {
+	var bounds struct {
+		Oldest uint
+		Newest uint
+	}
+	if err := db.Model(&StoreChange{}).Select("COALESCE(MIN(id), 0) AS oldest, COALESCE(MAX(id), 0) AS newest").Scan(&bounds).Error; err != nil {
+		return 0, 0, fmt.Errorf("failed to read store change bounds: %w", err)
+	}
+	return bounds.Oldest, bounds.Newest, nil
+}
+
+// PruneStoreChanges drops changes recorded before the given time. Watchers
+// resuming from a pruned ID start over from a snapshot.
+func PruneStoreChanges(db *gorm.DB, before time.Time) (int64, error) {
+	result := db.Where("created_at < ?", before).Delete(&StoreChange{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune store changes: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Condition types reported for every store
+const (
+	ConditionDatabaseReady      = "DatabaseReady"
+	ConditionAppReady           = "AppReady"
+	ConditionIngressReady       = "IngressReady"
+	ConditionTLSReady           = "TLSReady"
+	ConditionHealthCheckPassing = "HealthCheckPassing"
+)
+
+// Condition status values
+const (
+	ConditionTrue    = "True"
+	ConditionFalse   = "False"
+	ConditionUnknown = "Unknown"
+)
+
+// Condition describes one aspect of a store's health, in the style of Kubernetes status conditions
+type Condition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"` // True, False or Unknown
+	Reason             string    `json:"reason"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"last_transition_time"`
+}
+
+// Conditions is the list of conditions persisted on a store
+type Conditions []Condition
+
+// Get returns the condition of the given type, or nil
+func (c Conditions) Get(conditionType string) *Condition {
+	for i := range c {
+		if c[i].Type == conditionType {
+			return &c[i]
+		}
+	}
+	return nil
+}
+
+// Set adds or updates a condition. LastTransitionTime only moves when the
+// status flips. It reports whether anything changed.
+func (c *Conditions) Set(condition Condition) bool {
+	existing := c.Get(condition.Type)
+	if existing == nil {
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = time.Now()
+		}
+		*c = append(*c, condition)
+		return true
+	}
+
+	if existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+		return false
+	}
+	if existing.Status != condition.Status {
+		existing.LastTransitionTime = time.Now()
+	}
+	existing.Status = condition.Status
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+	return true
+}
+
+// Remove drops the condition of the given type. It reports whether anything changed.
+func (c *Conditions) Remove(conditionType string) bool {
+	for i := range *c {
+		if (*c)[i].Type == conditionType {
+			*c = append((*c)[:i], (*c)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Value stores the conditions as a JSON column
+func (c Conditions) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan reads the conditions from a JSON column
+func (c *Conditions) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return fmt.Errorf("unsupported type %T for conditions", value)
+	}
+}
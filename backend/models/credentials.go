@@ -0,0 +1,36 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrCredentialsRevealed is returned when reveal-once credentials were already revealed
+var ErrCredentialsRevealed = errors.New("credentials already revealed")
+
+// MarkCredentialsRevealed records that the store's credentials were revealed.
+// With once set it fails with ErrCredentialsRevealed if they already were, so
+// that only one of two concurrent reveals succeeds.
+func MarkCredentialsRevealed(db *gorm.DB, storeID string, once bool) (*Store, error) {
+	return retryOnConflict(db, storeID, func(store *Store) error {
+		if once && store.CredentialsRevealedAt != nil {
+			return ErrCredentialsRevealed
+		}
+		return UpdateStore(db, store, map[string]interface{}{
+			"credentials_revealed_at": time.Now(),
+		})
+	})
+}
+
+// MarkCredentialsRotated records a completed rotation, which makes reveal-once
+// credentials revealable again
+func MarkCredentialsRotated(db *gorm.DB, storeID string) (*Store, error) {
+	return retryOnConflict(db, storeID, func(store *Store) error {
+		return UpdateStore(db, store, map[string]interface{}{
+			"credentials_rotated_at":  time.Now(),
+			"credentials_revealed_at": nil,
+		})
+	})
+}
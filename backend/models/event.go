@@ -0,0 +1,82 @@
+package models
+
+import (
+	"log"
+	"time"
+	"urumi-backend/redact"
+
+	"gorm.io/gorm"
+)
+
+// Store event types
+const (
+	EventStoreCreated      = "StoreCreated"
+	EventInstallStarted    = "InstallStarted"
+	EventInstallSucceeded  = "InstallSucceeded"
+	EventInstallFailed     = "InstallFailed"
+	EventRetryScheduled    = "RetryScheduled"
+	EventRetryRequested    = "RetryRequested"
+	EventCancelRequested   = "CancelRequested"
+	EventCancelled         = "Cancelled"
+	EventCancelTooLate     = "CancelTooLate"
+	EventRollbackFailed    = "RollbackFailed"
+	EventCleanedUp         = "CleanedUp"
+	EventCleanupFailed     = "CleanupFailed"
+	EventResourcesKept     = "ResourcesKept"
+	EventStatusChanged     = "StatusChanged"
+	EventHealthCheckFailed = "HealthCheckFailed"
+	EventDeletionRequested = "DeletionRequested"
+	EventUninstallFailed   = "UninstallFailed"
+	EventStoreDeleted      = "StoreDeleted"
+	EventRecovered         = "Recovered"
+	EventCredentialsViewed = "CredentialsViewed"
+	EventRotationRequested = "CredentialsRotationRequested"
+	EventRotated           = "CredentialsRotated"
+	EventRotationFailed    = "CredentialsRotationFailed"
+	EventStoreUpdated      = "StoreUpdated"
+	EventUpgradeStarted    = "UpgradeStarted"
+	EventUpgradeSucceeded  = "UpgradeSucceeded"
+	EventUpgradeFailed     = "UpgradeFailed"
+	// Rollbacks of the Helm release to an earlier revision, unlike EventRollbackFailed
+	// which is about removing a cancelled install
+	EventReleaseRollbackRequested = "ReleaseRollbackRequested"
+	EventReleaseRolledBack        = "ReleaseRolledBack"
+	EventReleaseRollbackFailed    = "ReleaseRollbackFailed"
+)
+
+// Event actors
+const (
+	ActorAPI         = "api"
+	ActorProvisioner = "provisioner"
+	ActorReconciler  = "reconciler"
+	ActorRecovery    = "recovery"
+)
+
+// StoreEvent is one entry in a store's timeline. Events outlive the store so
+// a deleted or failed store can still be debugged after the fact.
+type StoreEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	StoreID   string    `json:"store_id" gorm:"index"`
+	Type      string    `json:"type"`
+	Actor     string    `json:"actor"` // api, provisioner, reconciler or recovery
+	Message   string    `json:"message"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// RecordEvent appends an event to the store's timeline. Failures are logged
+// rather than returned so that recording never breaks the operation itself.
+// Credentials in the message or details are redacted.
+func RecordEvent(db *gorm.DB, storeID, eventType, actor, message, details string) {
+	event := StoreEvent{
+		StoreID:   storeID,
+		Type:      eventType,
+		Actor:     actor,
+		Message:   redact.String(message),
+		Details:   redact.String(details),
+		CreatedAt: time.Now(),
+	}
+	if err := db.Create(&event).Error; err != nil {
+		log.Printf("Failed to record %s event for store %s: %v", eventType, storeID, err)
+	}
+}
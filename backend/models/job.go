@@ -0,0 +1,199 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"urumi-backend/redact"
+
+	"gorm.io/gorm"
+)
+
+// Job types
+const (
+	JobInstall           = "install"
+	JobUninstall         = "uninstall"
+	JobRotateCredentials = "rotate-credentials"
+	JobUpgrade           = "upgrade"
+	JobRollback          = "rollback"
+)
+
+// Job states
+const (
+	JobPending   = "Pending"
+	JobRunning   = "Running"
+	JobSucceeded = "Succeeded"
+	JobFailed    = "Failed"
+	JobCancelled = "Cancelled"
+)
+
+// Job is a unit of provisioning work persisted in the database so it survives restarts
+type Job struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	StoreID         string     `json:"store_id" gorm:"index"`
+	OperationID     string     `json:"operation_id,omitempty" gorm:"index"`
+	Type            string     `json:"type"`               // install, uninstall, rotate-credentials, upgrade or rollback
+	State           string     `json:"state" gorm:"index"` // Pending, Running, Succeeded or Failed
+	Attempts        int        `json:"attempts"`           // How many times a worker picked the job up
+	LastError       string     `json:"last_error,omitempty"`
+	CancelRequested bool       `json:"cancel_requested"`
+	Revision        int        `json:"revision,omitempty"` // Release revision a rollback job goes back to
+	RunAfter        time.Time  `json:"run_after"`          // The job is not picked up before this time
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// EnqueueJob persists a pending job for the store that carries out the given operation
+func EnqueueJob(db *gorm.DB, storeID, jobType, operationID string) (*Job, error) {
+	now := time.Now()
+	job := Job{
+		StoreID:     storeID,
+		OperationID: operationID,
+		Type:        jobType,
+		State:       JobPending,
+		RunAfter:    now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := db.Create(&job).Error; err != nil {
+		return nil, fmt.Errorf("failed to enqueue %s job for store %s: %w", jobType, storeID, err)
+	}
+	return &job, nil
+}
+
+// ClaimJob marks the oldest runnable job as Running and returns it, or nil if
+// there is none. Jobs of a store that already has a running job are held back
+// so that one store never has two helm operations in flight.
+func ClaimJob(db *gorm.DB) (*Job, error) {
+	for {
+		var job Job
+		err := db.Where("state = ? AND run_after <= ?", JobPending, time.Now()).
+			Where("store_id NOT IN (?)", db.Model(&Job{}).Select("store_id").Where("state = ?", JobRunning)).
+			Order("id").
+			First(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to find pending job: %w", err)
+		}
+
+		now := time.Now()
+		result := db.Model(&Job{}).
+			Where("id = ? AND state = ?", job.ID, JobPending).
+			Updates(map[string]interface{}{
+				"state":      JobRunning,
+				"attempts":   job.Attempts + 1,
+				"started_at": now,
+				"updated_at": now,
+			})
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to claim job %d: %w", job.ID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			// Another worker got there first
+			continue
+		}
+		job.State = JobRunning
+		job.Attempts++
+		job.StartedAt = &now
+		return &job, nil
+	}
+}
+
+// FinishJob records the outcome of a running job
+func FinishJob(db *gorm.DB, job *Job, jobErr error) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"state":       JobSucceeded,
+		"finished_at": now,
+		"updated_at":  now,
+	}
+	if jobErr != nil {
+		updates["state"] = JobFailed
+		updates["last_error"] = redact.Error(jobErr)
+	}
+	if err := db.Model(job).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to finish job %d: %w", job.ID, err)
+	}
+	return nil
+}
+
+// RequestJobCancel flags an active job for cancellation and makes it runnable
+// right away, so a job waiting for a retry is rolled back without delay.
+// It reports whether the job was still active.
+func RequestJobCancel(db *gorm.DB, job *Job) (bool, error) {
+	now := time.Now()
+	result := db.Model(&Job{}).
+		Where("id = ? AND state IN ?", job.ID, []string{JobPending, JobRunning}).
+		Updates(map[string]interface{}{
+			"cancel_requested": true,
+			"run_after":        now,
+			"updated_at":       now,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to cancel job %d: %w", job.ID, result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CancelJob records that a job was cancelled
+func CancelJob(db *gorm.DB, job *Job, reason string) error {
+	now := time.Now()
+	err := db.Model(job).Updates(map[string]interface{}{
+		"state":       JobCancelled,
+		"last_error":  reason,
+		"finished_at": now,
+		"updated_at":  now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to cancel job %d: %w", job.ID, err)
+	}
+	return nil
+}
+
+// RetryJob puts a failed running job back into the queue, to run again after runAfter
+func RetryJob(db *gorm.DB, job *Job, jobErr error, runAfter time.Time) error {
+	err := db.Model(job).Updates(map[string]interface{}{
+		"state":      JobPending,
+		"last_error": redact.Error(jobErr),
+		"run_after":  runAfter,
+		"updated_at": time.Now(),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to reschedule job %d: %w", job.ID, err)
+	}
+	return nil
+}
+
+// RequeueRunningJobs puts jobs that were running when the process stopped
+// back into the queue. It must only be called before any worker starts.
+func RequeueRunningJobs(db *gorm.DB) (int64, error) {
+	result := db.Model(&Job{}).
+		Where("state = ?", JobRunning).
+		Updates(map[string]interface{}{
+			"state":      JobPending,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to requeue interrupted jobs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// ActiveJob returns the pending or running job of the store, or nil
+func ActiveJob(db *gorm.DB, storeID string) (*Job, error) {
+	var job Job
+	err := db.Where("store_id = ? AND state IN ?", storeID, []string{JobPending, JobRunning}).
+		Order("id").
+		First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find active job for store %s: %w", storeID, err)
+	}
+	return &job, nil
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newSharedTestDB opens a database file that several connections use at once,
+// the way the workers share stores.db
+func newSharedTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "jobs.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&Job{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestClaimJobConcurrently(t *testing.T) {
+	db := newSharedTestDB(t)
+	const jobs = 40
+	for i := 0; i < jobs; i++ {
+		if _, err := EnqueueJob(db, fmt.Sprintf("store-%d", i), JobInstall, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		claimed = map[uint]int{}
+		wg      sync.WaitGroup
+	)
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := ClaimJob(db)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if job == nil {
+					return
+				}
+				mu.Lock()
+				claimed[job.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claimed) != jobs {
+		t.Fatalf("claimed %d distinct jobs, want %d", len(claimed), jobs)
+	}
+	for id, n := range claimed {
+		if n != 1 {
+			t.Errorf("job %d was claimed %d times", id, n)
+		}
+	}
+	var running int64
+	db.Model(&Job{}).Where("state = ? AND attempts = 1", JobRunning).Count(&running)
+	if running != jobs {
+		t.Fatalf("%d jobs are running with one attempt, want %d", running, jobs)
+	}
+}
+
+func TestClaimJobHoldsBackBusyStores(t *testing.T) {
+	db := newTestDB(t)
+	first, _ := EnqueueJob(db, "store-1", JobInstall, "")
+	second, _ := EnqueueJob(db, "store-1", JobUninstall, "")
+	later, _ := EnqueueJob(db, "store-2", JobInstall, "")
+	db.Model(later).Update("run_after", time.Now().Add(time.Hour))
+
+	job, err := ClaimJob(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID != first.ID {
+		t.Fatalf("claimed %+v, want job %d", job, first.ID)
+	}
+	// store-1 is busy and store-2's job is not due yet
+	if job, err := ClaimJob(db); err != nil || job != nil {
+		t.Fatalf("claimed %+v (%v) while the store's job is running", job, err)
+	}
+
+	if err := FinishJob(db, job, nil); err != nil {
+		t.Fatal(err)
+	}
+	if job, err := ClaimJob(db); err != nil || job == nil || job.ID != second.ID {
+		t.Fatalf("claimed %+v (%v) after the running job finished, want job %d", job, err, second.ID)
+	}
+}
+
+func TestRequeueRunningJobsReclaimsInterruptedJobs(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := EnqueueJob(db, "store-1", JobInstall, ""); err != nil {
+		t.Fatal(err)
+	}
+	interrupted, err := ClaimJob(db)
+	if err != nil || interrupted == nil {
+		t.Fatalf("ClaimJob = %+v, %v", interrupted, err)
+	}
+	// The process stops here; the job stays Running with nobody working on it
+	if job, err := ClaimJob(db); err != nil || job != nil {
+		t.Fatalf("claimed %+v (%v) while the job is running", job, err)
+	}
+
+	requeued, err := RequeueRunningJobs(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeued != 1 {
+		t.Fatalf("requeued %d jobs, want 1", requeued)
+	}
+	job, err := ClaimJob(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID != interrupted.ID || job.Attempts != 2 {
+		t.Fatalf("claimed %+v after the restart, want job %d on its second attempt", job, interrupted.ID)
+	}
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Store statuses
+const (
+	StatusProvisioning   = "Provisioning"
+	StatusReady          = "Ready"
+	StatusDegraded       = "Degraded"
+	StatusFailed         = "Failed"
+	StatusLost           = "Lost"
+	StatusDeleting       = "Deleting"
+	StatusDeletionFailed = "DeletionFailed"
+	StatusCancelled      = "Cancelled"
+)
+
+// storeTransitions lists, for every status, the statuses a store may move to.
+// Failed, Lost and Cancelled stores can be provisioned again by a retry. A successful
+// deletion removes the row, so Deleting has no way back.
+var storeTransitions = map[string][]string{
+	StatusProvisioning:   {StatusReady, StatusFailed, StatusCancelled, StatusDeleting},
+	StatusReady:          {StatusDegraded, StatusFailed, StatusLost, StatusDeleting},
+	StatusDegraded:       {StatusReady, StatusFailed, StatusLost, StatusDeleting},
+	StatusFailed:         {StatusProvisioning, StatusReady, StatusDegraded, StatusLost, StatusDeleting},
+	StatusLost:           {StatusProvisioning, StatusReady, StatusDegraded, StatusFailed, StatusDeleting},
+	StatusDeleting:       {StatusDeletionFailed},
+	StatusDeletionFailed: {StatusDeleting},
+	StatusCancelled:      {StatusProvisioning, StatusDeleting},
+}
+
+var (
+	// ErrInvalidTransition is returned when a status change is not allowed by the state machine
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrVersionConflict is returned when the store was modified since it was read
+	ErrVersionConflict = errors.New("store was modified concurrently")
+	// ErrSpecChanged is returned by UpdateSpec when another update changed the store's spec first
+	ErrSpecChanged = errors.New("store spec was changed concurrently")
+)
+
+// maxConflictRetries bounds how often Transition re-reads a store after a version conflict
+const maxConflictRetries = 3
+
+// CanTransition reports whether a store may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, allowed := range storeTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateStore writes the given columns if the store still has the version it
+// was read at, and bumps the version. On success store is updated in place.
+func UpdateStore(db *gorm.DB, store *Store, updates map[string]interface{}) error {
+	columns := make(map[string]interface{}, len(updates)+2)
+	for column, value := range updates {
+		columns[column] = value
+	}
+	columns["version"] = store.Version + 1
+	columns["updated_at"] = time.Now()
+
+	result := db.Model(&Store{}).
+		Where("id = ? AND version = ?", store.ID, store.Version).
+		Updates(columns)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update store %s: %w", store.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("store %s at version %d: %w", store.ID, store.Version, ErrVersionConflict)
+	}
+
+	// Reflect the write in the caller's copy
+	if err := db.First(store, "id = ?", store.ID).Error; err != nil {
+		return err
+	}
+	RecordStoreChange(db, ChangeUpdated, store)
+	return nil
+}
+
+// TransitionStatus moves the store to a new status, writing any extra columns
+// in the same versioned update and recording the change in the store's timeline.
+// Illegal transitions are rejected and logged.
+func TransitionStatus(db *gorm.DB, store *Store, to, reason, actor string, updates map[string]interface{}) error {
+	if !CanTransition(store.Status, to) {
+		log.Printf("Rejected status transition for store %s: %s -> %s (%s)", store.ID, store.Status, to, reason)
+		return fmt.Errorf("store %s cannot move from %s to %s: %w", store.ID, store.Status, to, ErrInvalidTransition)
+	}
+
+	columns := map[string]interface{}{
+		"status":        to,
+		"status_reason": reason,
+	}
+	for column, value := range updates {
+		columns[column] = value
+	}
+
+	from := store.Status
+	if err := UpdateStore(db, store, columns); err != nil {
+		return err
+	}
+	log.Printf("Store %s status: %s -> %s (%s)", store.ID, from, to, reason)
+	RecordEvent(db, store.ID, EventStatusChanged, actor, fmt.Sprintf("%s -> %s", from, to), reason)
+	return nil
+}
+
+// Transition re-reads the store and moves it to a new status, retrying when a
+// concurrent writer bumps the version in between. It is meant for writers that
+// report an outcome (such as a finished install) rather than act on a status they observed.
+func Transition(db *gorm.DB, storeID, to, reason, actor string, updates map[string]interface{}) (*Store, error) {
+	return retryOnConflict(db, storeID, func(store *Store) error {
+		return TransitionStatus(db, store, to, reason, actor, updates)
+	})
+}
+
+// UpdateLatest re-reads the store and writes the columns with UpdateStore,
+// retrying on version conflicts. The store must still have the expected status.
+func UpdateLatest(db *gorm.DB, storeID, status string, updates map[string]interface{}) (*Store, error) {
+	return retryOnConflict(db, storeID, func(store *Store) error {
+		if store.Status != status {
+			return fmt.Errorf("store %s is %s, expected %s: %w", store.ID, store.Status, status, ErrInvalidTransition)
+		}
+		return UpdateStore(db, store, updates)
+	})
+}
+
+// UpdateColumns re-reads the store and writes the columns with UpdateStore,
+// whatever its status, retrying on version conflicts
+func UpdateColumns(db *gorm.DB, storeID string, updates map[string]interface{}) (*Store, error) {
+	return retryOnConflict(db, storeID, func(store *Store) error {
+		return UpdateStore(db, store, updates)
+	})
+}
+
+// UpdateSpec re-reads the store and writes the columns with UpdateStore,
+// retrying on version conflicts. Other writers, such as the reconciler, leave
+// the spec alone, so the update fails with ErrSpecChanged only when the name,
+// image tag, plan or values it was based on changed. With statuses given the
+// store must still have one of them.
+func UpdateSpec(db *gorm.DB, base *Store, updates map[string]interface{}, statuses ...string) (*Store, error) {
+	return retryOnConflict(db, base.ID, func(store *Store) error {
+		sameValues := len(store.Values) == 0 && len(base.Values) == 0 || reflect.DeepEqual(store.Values, base.Values)
+		if store.Name != base.Name || store.ImageTag != base.ImageTag || store.Plan != base.Plan || !sameValues {
+			return ErrSpecChanged
+		}
+		if len(statuses) > 0 && !slices.Contains(statuses, store.Status) {
+			return fmt.Errorf("store %s is %s, expected one of %v: %w", store.ID, store.Status, statuses, ErrInvalidTransition)
+		}
+		return UpdateStore(db, store, updates)
+	})
+}
+
+// retryOnConflict loads the store and applies write, re-reading it after a version conflict
+func retryOnConflict(db *gorm.DB, storeID string, write func(store *Store) error) (*Store, error) {
+	var store Store
+	for attempt := 0; ; attempt++ {
+		if err := db.First(&store, "id = ?", storeID).Error; err != nil {
+			return nil, err
+		}
+		err := write(&store)
+		if errors.Is(err, ErrVersionConflict) && attempt < maxConflictRetries {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &store, nil
+	}
+}
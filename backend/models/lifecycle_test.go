@@ -0,0 +1,195 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens an empty in-memory database with the store tables
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a new database, so keep to one
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&Store{}, &StoreEvent{}, &StoreChange{}, &Job{}, &Operation{}, &ProvisionAttempt{}, &ProvisionLogLine{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// createTestStore saves a store with the given status at version 1
+func createTestStore(t *testing.T, db *gorm.DB, status string) Store {
+	t.Helper()
+	store := Store{ID: "store-1", Name: "Test Shop", Type: "woocommerce", Status: status, Namespace: "store-1", Version: 1}
+	if err := db.Create(&store).Error; err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{StatusProvisioning, StatusReady, true},
+		{StatusProvisioning, StatusFailed, true},
+		{StatusProvisioning, StatusCancelled, true},
+		{StatusProvisioning, StatusDeleting, true},
+		{StatusProvisioning, StatusLost, false},
+		{StatusProvisioning, StatusDegraded, false},
+		{StatusReady, StatusDegraded, true},
+		{StatusReady, StatusLost, true},
+		{StatusReady, StatusProvisioning, false},
+		{StatusReady, StatusCancelled, false},
+		{StatusDegraded, StatusReady, true},
+		{StatusFailed, StatusProvisioning, true},
+		{StatusLost, StatusProvisioning, true},
+		{StatusCancelled, StatusProvisioning, true},
+		{StatusCancelled, StatusReady, false},
+		{StatusDeleting, StatusDeletionFailed, true},
+		{StatusDeleting, StatusReady, false},
+		{StatusDeleting, StatusProvisioning, false},
+		{StatusDeletionFailed, StatusDeleting, true},
+		{StatusDeletionFailed, StatusReady, false},
+		{"Unknown", StatusReady, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.allowed {
+			t.Errorf("CanTransition(%s, %s) = %t, want %t", tt.from, tt.to, got, tt.allowed)
+		}
+	}
+}
+
+func TestTransitionStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		wantErr  error
+	}{
+		{"install finished", StatusProvisioning, StatusReady, nil},
+		{"deletion requested", StatusReady, StatusDeleting, nil},
+		{"retry after failure", StatusFailed, StatusProvisioning, nil},
+		{"deleting store cannot recover", StatusDeleting, StatusReady, ErrInvalidTransition},
+		{"ready store cannot be provisioned", StatusReady, StatusProvisioning, ErrInvalidTransition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			store := createTestStore(t, db, tt.from)
+
+			err := TransitionStatus(db, &store, tt.to, "test", ActorAPI, map[string]interface{}{"error_code": "X"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TransitionStatus(%s -> %s) = %v, want %v", tt.from, tt.to, err, tt.wantErr)
+			}
+
+			var saved Store
+			if err := db.First(&saved, "id = ?", store.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			var events int64
+			db.Model(&StoreEvent{}).Where("store_id = ? AND type = ?", store.ID, EventStatusChanged).Count(&events)
+
+			if tt.wantErr != nil {
+				if saved.Status != tt.from || saved.Version != 1 || saved.ErrorCode != "" || events != 0 {
+					t.Fatalf("rejected transition changed the store: status %s, version %d, error code %q, %d events", saved.Status, saved.Version, saved.ErrorCode, events)
+				}
+				return
+			}
+			if saved.Status != tt.to || saved.StatusReason != "test" || saved.ErrorCode != "X" {
+				t.Fatalf("store is %s (%s) with error code %q, want %s (test) with X", saved.Status, saved.StatusReason, saved.ErrorCode, tt.to)
+			}
+			if saved.Version != 2 || store.Version != 2 {
+				t.Fatalf("version is %d in the database and %d in the caller's copy, want 2", saved.Version, store.Version)
+			}
+			if events != 1 {
+				t.Fatalf("recorded %d status events, want 1", events)
+			}
+		})
+	}
+}
+
+func TestUpdateStoreVersionConflict(t *testing.T) {
+	db := newTestDB(t)
+	first := createTestStore(t, db, StatusReady)
+	second := first
+
+	if err := UpdateStore(db, &first, map[string]interface{}{"name": "First"}); err != nil {
+		t.Fatal(err)
+	}
+	// second was read at version 1, which is gone now
+	err := UpdateStore(db, &second, map[string]interface{}{"name": "Second"})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("stale UpdateStore = %v, want %v", err, ErrVersionConflict)
+	}
+	if err := TransitionStatus(db, &second, StatusDegraded, "stale", ActorReconciler, nil); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("stale TransitionStatus = %v, want %v", err, ErrVersionConflict)
+	}
+
+	var saved Store
+	if err := db.First(&saved, "id = ?", first.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.Name != "First" || saved.Status != StatusReady || saved.Version != 2 {
+		t.Fatalf("store is %q, %s at version %d; want the first write only", saved.Name, saved.Status, saved.Version)
+	}
+}
+
+func TestTransitionRereadsAfterConflict(t *testing.T) {
+	db := newTestDB(t)
+	stale := createTestStore(t, db, StatusProvisioning)
+	if err := UpdateStore(db, &stale, map[string]interface{}{"status_reason": "installing"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Transition reads the latest version itself, so a concurrent write doesn't lose the outcome
+	store, err := Transition(db, stale.ID, StatusReady, "helm install completed", ActorProvisioner, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Status != StatusReady || store.Version != 3 {
+		t.Fatalf("store is %s at version %d, want %s at version 3", store.Status, store.Version, StatusReady)
+	}
+
+	// Re-reading never makes an illegal transition legal
+	if _, err := Transition(db, stale.ID, StatusProvisioning, "retry", ActorAPI, nil); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Transition(Ready -> Provisioning) = %v, want %v", err, ErrInvalidTransition)
+	}
+}
+
+func TestUpdateSpecRereadsAfterConflict(t *testing.T) {
+	db := newTestDB(t)
+	base := createTestStore(t, db, StatusReady)
+	// The reconciler writes the store after the request read it
+	if _, err := UpdateColumns(db, base.ID, map[string]interface{}{"status_reason": "all pods running"}); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := UpdateSpec(db, &base, map[string]interface{}{"image_tag": "6.5"}, StatusReady, StatusDegraded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.ImageTag != "6.5" || store.StatusReason != "all pods running" || store.Version != 3 {
+		t.Fatalf("store has image %q, reason %q at version %d; want both writes at version 3", store.ImageTag, store.StatusReason, store.Version)
+	}
+
+	// base still has the old image tag, so another update based on it is refused
+	if _, err := UpdateSpec(db, &base, map[string]interface{}{"plan": "small"}); !errors.Is(err, ErrSpecChanged) {
+		t.Fatalf("UpdateSpec with a stale spec = %v, want %v", err, ErrSpecChanged)
+	}
+	if _, err := UpdateSpec(db, store, map[string]interface{}{"plan": "small"}, StatusDegraded); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("UpdateSpec of a Ready store expecting Degraded = %v, want %v", err, ErrInvalidTransition)
+	}
+}
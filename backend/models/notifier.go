@@ -0,0 +1,36 @@
+package models
+
+import "sync"
+
+// notifier wakes up subscribers when something was written. Signals are
+// coalesced, so subscribers re-read what they follow instead of counting them.
+type notifier struct {
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+func (n *notifier) subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	n.mu.Lock()
+	if n.subscribers == nil {
+		n.subscribers = make(map[chan struct{}]struct{})
+	}
+	n.subscribers[ch] = struct{}{}
+	n.mu.Unlock()
+	return ch, func() {
+		n.mu.Lock()
+		delete(n.subscribers, ch)
+		n.mu.Unlock()
+	}
+}
+
+func (n *notifier) notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for ch := range n.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"urumi-backend/redact"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Operation types
+const (
+	OperationCreate            = "create"
+	OperationDelete            = "delete"
+	OperationRetry             = "retry"
+	OperationRotateCredentials = "rotate-credentials"
+	OperationUpgrade           = "upgrade"
+	OperationRollback          = "rollback"
+)
+
+// Operation phases, in the order an operation usually goes through them
+const (
+	PhaseQueued          = "Queued"
+	PhaseStarting        = "Starting"
+	PhaseInstalling      = "Installing"
+	PhaseWaitingForRetry = "WaitingForRetry"
+	PhaseCleaningUp      = "CleaningUp"
+	PhaseRollingBack     = "RollingBack"
+	PhaseUninstalling    = "Uninstalling"
+	PhaseRotating        = "RotatingCredentials"
+	PhaseUpgrading       = "Upgrading"
+	PhaseVerifyingHealth = "VerifyingHealth"
+	PhaseDone            = "Done"
+)
+
+// Operation tracks an asynchronous action on a store so clients can wait on
+// it instead of polling the store. Its state mirrors the job that carries it out.
+type Operation struct {
+	ID         string     `json:"id" gorm:"primaryKey"`
+	Type       string     `json:"type"` // create, delete, retry, rotate-credentials, upgrade or rollback
+	StoreID    string     `json:"store_id" gorm:"index"`
+	State      string     `json:"state"` // Pending, Running, Succeeded, Failed or Cancelled
+	Phase      string     `json:"phase"` // Progress within the operation, e.g. Installing
+	Percent    int        `json:"percent"`
+	Result     string     `json:"result,omitempty"`
+	ErrorCode  string     `json:"error_code,omitempty"` // Classified cause of a failure, e.g. QuotaExceeded
+	Error      string     `json:"error,omitempty"`      // What went wrong and what to do about it
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// CreateOperation persists a new pending operation on the store
+func CreateOperation(db *gorm.DB, storeID, operationType string) (*Operation, error) {
+	now := time.Now()
+	operation := Operation{
+		ID:        uuid.New().String(),
+		Type:      operationType,
+		StoreID:   storeID,
+		State:     JobPending,
+		Phase:     PhaseQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := db.Create(&operation).Error; err != nil {
+		return nil, fmt.Errorf("failed to create %s operation for store %s: %w", operationType, storeID, err)
+	}
+	return &operation, nil
+}
+
+// StartOperation creates an operation together with the job that carries it out
+func StartOperation(db *gorm.DB, storeID, operationType, jobType string) (*Operation, error) {
+	var operation *Operation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if operation, err = CreateOperation(tx, storeID, operationType); err != nil {
+			return err
+		}
+		_, err = EnqueueJob(tx, storeID, jobType, operation.ID)
+		return err
+	})
+	return operation, err
+}
+
+// UpdateOperationProgress records the state, phase and percent of a running operation
+func UpdateOperationProgress(db *gorm.DB, operationID, state, phase string, percent int) error {
+	if operationID == "" {
+		return nil
+	}
+	now := time.Now()
+	updates := map[string]interface{}{
+		"state":      state,
+		"phase":      phase,
+		"percent":    percent,
+		"updated_at": now,
+	}
+	if state == JobRunning {
+		// Only the first attempt sets the start time
+		updates["started_at"] = gorm.Expr("COALESCE(started_at, ?)", now)
+	}
+	if err := db.Model(&Operation{}).Where("id = ?", operationID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update operation %s: %w", operationID, err)
+	}
+	return nil
+}
+
+// FinishOperation records the final state of an operation with its result or
+// error, redacting any credentials in the error
+func FinishOperation(db *gorm.DB, operationID, state, result, errorCode, errMessage string) error {
+	if operationID == "" {
+		return nil
+	}
+	now := time.Now()
+	err := db.Model(&Operation{}).Where("id = ?", operationID).Updates(map[string]interface{}{
+		"state":       state,
+		"phase":       PhaseDone,
+		"percent":     100,
+		"result":      result,
+		"error_code":  errorCode,
+		"error":       redact.String(errMessage),
+		"finished_at": now,
+		"updated_at":  now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to finish operation %s: %w", operationID, err)
+	}
+	return nil
+}
+
+// GetOperation returns the operation with the given ID, or nil if there is none
+func GetOperation(db *gorm.DB, operationID string) (*Operation, error) {
+	if operationID == "" {
+		return nil, nil
+	}
+	var operation Operation
+	err := db.First(&operation, "id = ?", operationID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load operation %s: %w", operationID, err)
+	}
+	return &operation, nil
+}
+
+// StartRollback creates a rollback operation together with the job that rolls
+// the store's release back to the given revision
+func StartRollback(db *gorm.DB, storeID string, revision int) (*Operation, error) {
+	var operation *Operation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if operation, err = CreateOperation(tx, storeID, OperationRollback); err != nil {
+			return err
+		}
+		job, err := EnqueueJob(tx, storeID, JobRollback, operation.ID)
+		if err != nil {
+			return err
+		}
+		return tx.Model(job).Update("revision", revision).Error
+	})
+	return operation, err
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"urumi-backend/redact"
+
+	"gorm.io/gorm"
+)
+
+// ProvisionAttempt is one run of a store's install, with its own log
+type ProvisionAttempt struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	StoreID     string     `json:"store_id" gorm:"index"`
+	OperationID string     `json:"operation_id,omitempty"`
+	JobID       uint       `json:"job_id"`
+	Number      int        `json:"number"` // Counts the store's install attempts, starting at 1
+	State       string     `json:"state"`  // Running, Succeeded, Failed or Cancelled
+	ErrorCode   string     `json:"error_code,omitempty"`
+	ErrorHint   string     `json:"error_hint,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// ProvisionLogLine is one line of output of a provisioning attempt. Its ID
+// increases monotonically and is used as the SSE event ID of the log stream.
+type ProvisionLogLine struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	StoreID   string    `json:"store_id" gorm:"index"`
+	AttemptID uint      `json:"attempt_id" gorm:"index"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// provisionLogs wakes up log streams whenever a line is appended
+var provisionLogs notifier
+
+// StartProvisionAttempt records the start of an install attempt for the job
+func StartProvisionAttempt(db *gorm.DB, job *Job, number int) (*ProvisionAttempt, error) {
+	attempt := ProvisionAttempt{
+		StoreID:     job.StoreID,
+		OperationID: job.OperationID,
+		JobID:       job.ID,
+		Number:      number,
+		State:       JobRunning,
+		StartedAt:   time.Now(),
+	}
+	if err := db.Create(&attempt).Error; err != nil {
+		return nil, fmt.Errorf("failed to record install attempt %d of store %s: %w", number, job.StoreID, err)
+	}
+	return &attempt, nil
+}
+
+// FinishProvisionAttempt records the outcome of an install attempt, with the
+// classified cause if it failed
+func FinishProvisionAttempt(db *gorm.DB, attempt *ProvisionAttempt, state, errorCode, errorHint string) error {
+	now := time.Now()
+	if err := db.Model(attempt).Updates(map[string]interface{}{
+		"state":       state,
+		"error_code":  errorCode,
+		"error_hint":  errorHint,
+		"finished_at": now,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to finish install attempt %d of store %s: %w", attempt.Number, attempt.StoreID, err)
+	}
+	return nil
+}
+
+// AppendProvisionLog adds output to the attempt's log, one row per line.
+// Like RecordEvent it only logs failures, so logging never fails an install,
+// and redacts credentials.
+func AppendProvisionLog(db *gorm.DB, attempt *ProvisionAttempt, output string) {
+	now := time.Now()
+	for _, text := range strings.Split(strings.TrimRight(redact.String(output), "\n"), "\n") {
+		line := ProvisionLogLine{
+			StoreID:   attempt.StoreID,
+			AttemptID: attempt.ID,
+			Text:      text,
+			CreatedAt: now,
+		}
+		if err := db.Create(&line).Error; err != nil {
+			log.Printf("Failed to append to install log of store %s: %v", attempt.StoreID, err)
+			return
+		}
+	}
+	provisionLogs.notify()
+}
+
+// SubscribeProvisionLogs returns a channel that receives a signal after log lines
+// are appended to any attempt, and a function that unsubscribes it
+func SubscribeProvisionLogs() (<-chan struct{}, func()) {
+	return provisionLogs.subscribe()
+}
+
+// ListProvisionAttempts returns the store's install attempts, oldest first
+func ListProvisionAttempts(db *gorm.DB, storeID string) ([]ProvisionAttempt, error) {
+	var attempts []ProvisionAttempt
+	if err := db.Where("store_id = ?", storeID).Order("id").Find(&attempts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list install attempts of store %s: %w", storeID, err)
+	}
+	return attempts, nil
+}
+
+// GetProvisionAttempt returns the store's install attempt with the given number, or nil
+func GetProvisionAttempt(db *gorm.DB, storeID string, number int) (*ProvisionAttempt, error) {
+	var attempt ProvisionAttempt
+	err := db.Where("store_id = ? AND number = ?", storeID, number).Order("id DESC").First(&attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find install attempt %d of store %s: %w", number, storeID, err)
+	}
+	return &attempt, nil
+}
+
+// LatestProvisionAttempt returns the store's most recent install attempt, or nil
+func LatestProvisionAttempt(db *gorm.DB, storeID string) (*ProvisionAttempt, error) {
+	var attempt ProvisionAttempt
+	err := db.Where("store_id = ?", storeID).Order("id DESC").First(&attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find latest install attempt of store %s: %w", storeID, err)
+	}
+	return &attempt, nil
+}
+
+// ProvisionLogSince returns up to limit log lines of the store's attempts from
+// fromAttemptID on, recorded after the given line ID, oldest first
+func ProvisionLogSince(db *gorm.DB, storeID string, fromAttemptID, afterID uint, limit int) ([]ProvisionLogLine, error) {
+	var lines []ProvisionLogLine
+	err := db.Where("store_id = ? AND attempt_id >= ? AND id > ?", storeID, fromAttemptID, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&lines).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read install log of store %s: %w", storeID, err)
+	}
+	return lines, nil
+}
+
+// ProvisionOutput returns an attempt's log as text, one line per log line
+func ProvisionOutput(db *gorm.DB, attempt *ProvisionAttempt) (string, error) {
+	lines, err := ProvisionLog(db, attempt)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for _, line := range lines {
+		out.WriteString(line.Text)
+		out.WriteString("\n")
+	}
+	return out.String(), nil
+}
+
+// ProvisionLog returns every line of an attempt's log, oldest first
+func ProvisionLog(db *gorm.DB, attempt *ProvisionAttempt) ([]ProvisionLogLine, error) {
+	var lines []ProvisionLogLine
+	if err := db.Where("attempt_id = ?", attempt.ID).Order("id").Find(&lines).Error; err != nil {
+		return nil, fmt.Errorf("failed to read log of install attempt %d of store %s: %w", attempt.Number, attempt.StoreID, err)
+	}
+	return lines, nil
+}
+
+// PruneProvisionLogs drops the install attempts of deleted stores, and all but
+// the latest keep attempts of every other store, together with their logs. It
+// returns how many log lines were dropped.
+func PruneProvisionLogs(db *gorm.DB, keep int) (int64, error) {
+	var stale []uint
+	err := db.Raw(`SELECT id FROM (
+			SELECT id, store_id, ROW_NUMBER() OVER (PARTITION BY store_id ORDER BY id DESC) AS newer
+			FROM provision_attempts
+		) WHERE newer > ? OR store_id NOT IN (SELECT id FROM stores)`, keep).
+		Scan(&stale).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find install attempts to prune: %w", err)
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+
+	var pruned int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("attempt_id IN ?", stale).Delete(&ProvisionLogLine{})
+		if result.Error != nil {
+			return result.Error
+		}
+		pruned = result.RowsAffected
+		return tx.Where("id IN ?", stale).Delete(&ProvisionAttempt{}).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune install logs: %w", err)
+	}
+	return pruned, nil
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPruneProvisionLogs(t *testing.T) {
+	db := newTestDB(t)
+	store := createTestStore(t, db, StatusReady)
+	var attempts []*ProvisionAttempt
+	for number := 1; number <= 3; number++ {
+		attempt, err := StartProvisionAttempt(db, &Job{ID: uint(number), StoreID: store.ID}, number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		AppendProvisionLog(db, attempt, fmt.Sprintf("attempt %d\ndone", number))
+		attempts = append(attempts, attempt)
+	}
+	// The attempt of a store that was deleted since
+	gone, err := StartProvisionAttempt(db, &Job{ID: 4, StoreID: "deleted-store"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AppendProvisionLog(db, gone, "installing")
+
+	pruned, err := PruneProvisionLogs(db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 3 {
+		t.Fatalf("pruned %d log lines, want the first attempt's 2 and the deleted store's 1", pruned)
+	}
+	kept, err := ListProvisionAttempts(db, store.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 2 || kept[0].ID != attempts[1].ID || kept[1].ID != attempts[2].ID {
+		t.Fatalf("kept attempts %+v, want the latest two", kept)
+	}
+	if lines, err := ProvisionLog(db, attempts[2]); err != nil || len(lines) != 2 {
+		t.Fatalf("latest attempt has %d log lines (%v), want 2", len(lines), err)
+	}
+	if attempt, err := LatestProvisionAttempt(db, "deleted-store"); err != nil || attempt != nil {
+		t.Fatalf("the deleted store's attempt %+v (%v) was kept", attempt, err)
+	}
+
+	// Nothing is left to prune
+	if pruned, err := PruneProvisionLogs(db, 2); err != nil || pruned != 0 {
+		t.Fatalf("second prune dropped %d lines (%v)", pruned, err)
+	}
+}
@@ -1,17 +1,94 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
 type Store struct {
-	ID        string    `json:"id" gorm:"primaryKey"`
-	Name      string    `json:"name"`
-	Type      string    `json:"type"` // "woocommerce" or "medusa"
-	Status    string    `json:"status"` // Provisioning, Ready, Failed, Deleting
-	URL       string    `json:"url"`
-	Namespace string    `json:"namespace"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	ErrorMessage *string `json:"error_message,omitempty"`
+	ID                    string      `json:"id" gorm:"primaryKey"`
+	Name                  string      `json:"name"`
+	Type                  string      `json:"type"`                              // Store type from the catalog, e.g. "woocommerce"
+	Plan                  string      `json:"plan"`                              // Size plan: resources, volume sizes and quota
+	ImageTag              string      `json:"image_tag,omitempty"`               // Desired app image version; empty uses the chart's default
+	Values                ChartValues `json:"values,omitempty" gorm:"type:text"` // Desired user-tunable chart values, by dotted key
+	Status                string      `json:"status"`                            // See lifecycle.go for the statuses and allowed transitions
+	StatusReason          string      `json:"status_reason,omitempty"`           // Why the store last changed status
+	URL                   string      `json:"url"`
+	Namespace             string      `json:"namespace"`
+	CreatedAt             time.Time   `json:"created_at"`
+	UpdatedAt             time.Time   `json:"updated_at"`
+	ErrorMessage          *string     `json:"-"`                                             // Raw error of the last failure; the API returns ErrorCode and ErrorHint instead
+	ErrorCode             string      `json:"error_code,omitempty"`                          // Classified cause of the last failure, e.g. ImagePullBackOff
+	ErrorHint             string      `json:"error_hint,omitempty"`                          // What the user can do about the last failure
+	KeepOnFailure         bool        `json:"keep_on_failure"`                               // Keep the release and namespace of a failed install for debugging
+	LeftoverResources     StringList  `json:"leftover_resources,omitempty" gorm:"type:text"` // Cluster resources left behind by a failed install
+	ProvisionAttempts     int         `json:"provision_attempts"`                            // Install attempts made for this store, across retries
+	NextRetryAt           *time.Time  `json:"next_retry_at,omitempty"`                       // When the next automatic install retry is due
+	CredentialsRevealedAt *time.Time  `json:"credentials_revealed_at,omitempty"`             // When the credentials were last revealed through the API
+	CredentialsRotatedAt  *time.Time  `json:"credentials_rotated_at,omitempty"`              // When the credentials were last rotated
+	Version               int         `json:"version" gorm:"not null;default:1"`             // Bumped on every write, for optimistic concurrency
+	Conditions            Conditions  `json:"conditions" gorm:"type:text"`                   // Per-component health, maintained by the reconciler
+}
+
+// StringList is a list of strings stored as a JSON column
+type StringList []string
+
+// Value stores the list as JSON
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan reads the list from a JSON column
+func (l *StringList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	default:
+		return fmt.Errorf("unsupported type %T for string list", value)
+	}
+}
+
+// ChartValues are chart values keyed by their dotted path, stored as a JSON column
+type ChartValues map[string]interface{}
+
+// Value stores the values as JSON
+func (v ChartValues) Value() (driver.Value, error) {
+	if v == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan reads the values from a JSON column
+func (v *ChartValues) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(data, v)
+	case string:
+		return json.Unmarshal([]byte(data), v)
+	default:
+		return fmt.Errorf("unsupported type %T for chart values", value)
+	}
 }
@@ -0,0 +1,156 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"urumi-backend/models"
+	"urumi-backend/redact"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// IngressStatus is the observed state of one ingress in a store namespace
+type IngressStatus struct {
+	Name string
+	// Address is the load balancer address, empty until the controller admits the ingress.
+	Address string
+	// TLSSecrets are the certificate secrets the ingress references.
+	TLSSecrets []string
+	// MissingTLSSecrets are referenced secrets that do not exist or hold no certificate.
+	MissingTLSSecrets []string
+}
+
+// ingressStatuses reads the ingresses in the namespace and checks their certificate secrets
+func ingressStatuses(ctx context.Context, client kubernetes.Interface, namespace string) ([]IngressStatus, error) {
+	ingresses, err := client.NetworkingV1().Ingresses(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+
+	var statuses []IngressStatus
+	for _, ing := range ingresses.Items {
+		status := IngressStatus{Name: ing.Name}
+		for _, lb := range ing.Status.LoadBalancer.Ingress {
+			if lb.IP != "" {
+				status.Address = lb.IP
+			} else if lb.Hostname != "" {
+				status.Address = lb.Hostname
+			}
+		}
+		for _, tls := range ing.Spec.TLS {
+			if tls.SecretName == "" {
+				continue
+			}
+			status.TLSSecrets = append(status.TLSSecrets, tls.SecretName)
+			secret, err := client.CoreV1().Secrets(namespace).Get(ctx, tls.SecretName, metav1.GetOptions{})
+			switch {
+			case apierrors.IsNotFound(err):
+				status.MissingTLSSecrets = append(status.MissingTLSSecrets, tls.SecretName)
+			case err != nil:
+				return nil, fmt.Errorf("failed to get TLS secret %s: %w", tls.SecretName, err)
+			case len(secret.Data["tls.crt"]) == 0:
+				status.MissingTLSSecrets = append(status.MissingTLSSecrets, tls.SecretName)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// updateConditions sets the store's conditions from the observed cluster state.
+// It reports whether any condition changed.
+func updateConditions(ctx context.Context, prov Provisioner, store *models.Store, observed *StoreStatus) bool {
+	changed := false
+	set := func(conditionType, status, reason, message string) {
+		if store.Conditions.Set(models.Condition{Type: conditionType, Status: status, Reason: reason, Message: message}) {
+			changed = true
+		}
+	}
+
+	if !observed.NamespaceExists {
+		for _, conditionType := range []string{models.ConditionDatabaseReady, models.ConditionAppReady, models.ConditionIngressReady, models.ConditionTLSReady, models.ConditionHealthCheckPassing} {
+			if store.Conditions.Get(conditionType) != nil {
+				set(conditionType, models.ConditionUnknown, "NamespaceMissing", fmt.Sprintf("namespace %s does not exist", store.Namespace))
+			}
+		}
+		return changed
+	}
+
+	// Component conditions; store types without a database drop DatabaseReady
+	appReady := false
+	for _, pair := range [][2]string{{models.ConditionDatabaseReady, "database"}, {models.ConditionAppReady, "app"}} {
+		conditionType, component := pair[0], pair[1]
+		declared := false
+		for _, c := range componentsOf(store.Type) {
+			declared = declared || c.Name == component
+		}
+		if !declared {
+			if store.Conditions.Remove(conditionType) {
+				changed = true
+			}
+			continue
+		}
+
+		status := findComponent(observed.Components, component)
+		switch {
+		case status == nil:
+			set(conditionType, models.ConditionFalse, "NotFound", fmt.Sprintf("%s component has not been created", component))
+		case status.Ready:
+			set(conditionType, models.ConditionTrue, "Ready", status.Message)
+			appReady = appReady || component == "app"
+		default:
+			set(conditionType, models.ConditionFalse, status.Reason, status.Message)
+		}
+	}
+
+	// Ingress and TLS
+	var unadmitted, missingSecrets, tlsSecrets []string
+	for _, ing := range observed.Ingresses {
+		if ing.Address == "" {
+			unadmitted = append(unadmitted, ing.Name)
+		}
+		tlsSecrets = append(tlsSecrets, ing.TLSSecrets...)
+		missingSecrets = append(missingSecrets, ing.MissingTLSSecrets...)
+	}
+	switch {
+	case len(observed.Ingresses) == 0:
+		set(models.ConditionIngressReady, models.ConditionFalse, "NotFound", "no ingress in store namespace")
+	case len(unadmitted) > 0:
+		set(models.ConditionIngressReady, models.ConditionFalse, "NoAddress", fmt.Sprintf("ingress %s has no load balancer address yet", strings.Join(unadmitted, ", ")))
+	default:
+		set(models.ConditionIngressReady, models.ConditionTrue, "Admitted", fmt.Sprintf("routing %s", store.URL))
+	}
+	switch {
+	case len(tlsSecrets) == 0:
+		set(models.ConditionTLSReady, models.ConditionFalse, "NotConfigured", "ingress serves plain HTTP")
+	case len(missingSecrets) > 0:
+		set(models.ConditionTLSReady, models.ConditionFalse, "CertificateMissing", fmt.Sprintf("certificate secret %s not issued", strings.Join(missingSecrets, ", ")))
+	default:
+		set(models.ConditionTLSReady, models.ConditionTrue, "CertificateIssued", fmt.Sprintf("certificate in %s", strings.Join(tlsSecrets, ", ")))
+	}
+
+	// Health check, only meaningful once the app is up
+	if !appReady {
+		set(models.ConditionHealthCheckPassing, models.ConditionFalse, "AppNotReady", "waiting for app component")
+	} else if healthy, err := prov.CheckHealth(ctx, *store); err != nil {
+		set(models.ConditionHealthCheckPassing, models.ConditionFalse, "CheckFailed", redact.Error(err))
+	} else if !healthy {
+		set(models.ConditionHealthCheckPassing, models.ConditionFalse, "Unhealthy", "store endpoint reported unhealthy")
+	} else {
+		set(models.ConditionHealthCheckPassing, models.ConditionTrue, "Passing", fmt.Sprintf("%s is responding", store.URL))
+	}
+
+	return changed
+}
+
+func findComponent(components []ComponentStatus, name string) *ComponentStatus {
+	for i := range components {
+		if components[i].Required && components[i].Name == name {
+			return &components[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"urumi-backend/models"
+	"urumi-backend/redact"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CredentialsSecretName is the Secret in every store namespace that holds the
+// store's generated credentials. The chart reads it by name, so the passwords
+// never go through Helm values or the release history.
+const CredentialsSecretName = "store-credentials"
+
+// Keys of the credentials Secret. The MariaDB keys are the ones the Bitnami
+// chart expects in auth.existingSecret.
+const (
+	secretKeyAdminUsername = "admin-username"
+	secretKeyAdminPassword = "admin-password"
+	secretKeyRootPassword  = "mariadb-root-password"
+	secretKeyDBPassword    = "mariadb-password"
+)
+
+// defaultAdminUsername is the store admin account created by the chart
+const defaultAdminUsername = "admin"
+
+// ErrCredentialsNotFound is returned when a store has no credentials Secret
+var ErrCredentialsNotFound = errors.New("credentials not found")
+
+// Credentials are the generated passwords of a store
+type Credentials struct {
+	AdminUsername        string `json:"admin_username"`
+	AdminPassword        string `json:"admin_password"`
+	DatabasePassword     string `json:"database_password"`
+	DatabaseRootPassword string `json:"database_root_password"`
+}
+
+// generateCredentials creates a fresh set of random passwords
+func generateCredentials() (*Credentials, error) {
+	creds := &Credentials{AdminUsername: defaultAdminUsername}
+	for _, field := range []struct {
+		name string
+		into *string
+	}{
+		{"admin", &creds.AdminPassword},
+		{"database", &creds.DatabasePassword},
+		{"root", &creds.DatabaseRootPassword},
+	} {
+		password, err := generateSecurePassword(20)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate %s password: %w", field.name, err)
+		}
+		*field.into = password
+	}
+	creds.register()
+	return creds, nil
+}
+
+// register makes sure the passwords are redacted wherever they show up
+func (c *Credentials) register() {
+	redact.Register(c.AdminPassword, c.DatabasePassword, c.DatabaseRootPassword)
+}
+
+// unregister stops redacting the passwords once nothing uses them any more
+func (c *Credentials) unregister() {
+	redact.Unregister(c.AdminPassword, c.DatabasePassword, c.DatabaseRootPassword)
+}
+
+// secret builds the credentials Secret of a store
+func (c *Credentials) secret(store models.Store) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      CredentialsSecretName,
+			Namespace: store.Namespace,
+			Labels:    map[string]string{StoreIDLabel: store.ID},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: c.data(""),
+	}
+}
+
+// data returns the Secret keys of the credentials, each prefixed with prefix
+func (c *Credentials) data(prefix string) map[string][]byte {
+	return map[string][]byte{
+		prefix + secretKeyAdminUsername: []byte(c.AdminUsername),
+		prefix + secretKeyAdminPassword: []byte(c.AdminPassword),
+		prefix + secretKeyDBPassword:    []byte(c.DatabasePassword),
+		prefix + secretKeyRootPassword:  []byte(c.DatabaseRootPassword),
+	}
+}
+
+// credentialsFromSecret reads the credentials back from the store's Secret
+func credentialsFromSecret(secret *corev1.Secret) *Credentials {
+	return credentialsFromData(secret.Data, "")
+}
+
+// credentialsFromData reads the credentials stored under the keys with the given prefix
+func credentialsFromData(data map[string][]byte, prefix string) *Credentials {
+	creds := &Credentials{
+		AdminUsername:        string(data[prefix+secretKeyAdminUsername]),
+		AdminPassword:        string(data[prefix+secretKeyAdminPassword]),
+		DatabasePassword:     string(data[prefix+secretKeyDBPassword]),
+		DatabaseRootPassword: string(data[prefix+secretKeyRootPassword]),
+	}
+	creds.register()
+	return creds
+}
+
+// credentialsFromValues reads the passwords that stores created before the
+// credentials Secret existed passed to their release as values. It reports
+// whether the values held them at all.
+func credentialsFromValues(vals map[string]interface{}) (*Credentials, bool) {
+	lookup := func(paths ...string) string {
+		for _, path := range paths {
+			if v, err := chartutil.Values(vals).PathValue(path); err == nil {
+				if s, ok := v.(string); ok && s != "" {
+					return s
+				}
+			}
+		}
+		return ""
+	}
+	creds := &Credentials{
+		AdminUsername:        lookup("wordpress.username"),
+		AdminPassword:        lookup("wordpress.password"),
+		DatabasePassword:     lookup("mariadb.auth.password", "wordpress.db.password"),
+		DatabaseRootPassword: lookup("mariadb.auth.rootPassword"),
+	}
+	if creds.AdminPassword == "" || creds.DatabasePassword == "" || creds.DatabaseRootPassword == "" {
+		return nil, false
+	}
+	if creds.AdminUsername == "" {
+		creds.AdminUsername = defaultAdminUsername
+	}
+	creds.register()
+	return creds, true
+}
+
+// ensureCredentials creates the store's credentials Secret unless it exists.
+// Existing credentials are kept, since the database was initialised with them.
+// released are the values of the store's current release, or nil on a first
+// install; only a first install gets freshly generated passwords, an existing
+// release keeps the ones it was installed with.
+func (p *HelmProvisioner) ensureCredentials(ctx context.Context, store models.Store, released map[string]interface{}, logf LogFunc) error {
+	client, err := p.kubeClient()
+	if err != nil {
+		return err
+	}
+	secrets := client.CoreV1().Secrets(store.Namespace)
+	existing, err := secrets.Get(ctx, CredentialsSecretName, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		credentialsFromSecret(existing)
+		return nil
+	case !apierrors.IsNotFound(err):
+		return fmt.Errorf("failed to get credentials secret: %w", err)
+	}
+
+	if released != nil {
+		creds, ok := credentialsFromValues(released)
+		if !ok {
+			return fmt.Errorf("release %s has neither a credentials secret nor passwords in its values: %w", store.Namespace, ErrCredentialsNotFound)
+		}
+		if _, err := secrets.Create(ctx, creds.secret(store), metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create credentials secret: %w", err)
+		}
+		logf.printf("Created secret %s/%s with the credentials of release %s", store.Namespace, CredentialsSecretName, store.Namespace)
+		return nil
+	}
+
+	creds, err := generateCredentials()
+	if err != nil {
+		return err
+	}
+	if _, err := secrets.Create(ctx, creds.secret(store), metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create credentials secret: %w", err)
+	}
+	logf.printf("Created secret %s/%s with generated credentials", store.Namespace, CredentialsSecretName)
+	return nil
+}
+
+// Credentials reads the store's credentials from its Secret
+func (p *HelmProvisioner) Credentials(ctx context.Context, store models.Store) (*Credentials, error) {
+	client, err := p.kubeClient()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := client.CoreV1().Secrets(store.Namespace).Get(ctx, CredentialsSecretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, ErrCredentialsNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials secret: %w", err)
+	}
+	return credentialsFromSecret(secret), nil
+}
+
+func generateSecurePassword(length int) (string, error) {
+	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789" // Removed special chars to avoid shell escaping issues
+	b := make([]byte, length)
+	for i := range b {
+		num, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = charset[num.Int64()]
+	}
+	return string(b), nil
+}
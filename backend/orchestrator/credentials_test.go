@@ -0,0 +1,130 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"urumi-backend/models"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newFakeHelmProvisioner returns a HelmProvisioner whose Kubernetes client is a fake clientset
+func newFakeHelmProvisioner() (*HelmProvisioner, *fake.Clientset) {
+	client := fake.NewSimpleClientset()
+	p := &HelmProvisioner{}
+	p.clientOnce.Do(func() { p.client = client })
+	return p, client
+}
+
+func TestEnsureCredentialsMigratesReleaseValues(t *testing.T) {
+	p, client := newFakeHelmProvisioner()
+	store := models.Store{ID: "s1", Type: "woocommerce", Namespace: "store-s1"}
+	// What a store installed with --set passwords has in its release
+	released := map[string]interface{}{
+		"ingress": map[string]interface{}{"hosts": []interface{}{map[string]interface{}{"host": "store-s1.localhost"}}},
+		"mariadb": map[string]interface{}{"auth": map[string]interface{}{
+			"rootPassword": "Rootpass1234567",
+			"password":     "Dbpass12345678",
+		}},
+		"wordpress": map[string]interface{}{
+			"password": "password123",
+			"db":       map[string]interface{}{"password": "Dbpass12345678"},
+		},
+	}
+
+	if err := p.ensureCredentials(context.Background(), store, released, nil); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := client.CoreV1().Secrets(store.Namespace).Get(context.Background(), CredentialsSecretName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Credentials{
+		AdminUsername:        defaultAdminUsername,
+		AdminPassword:        "password123",
+		DatabasePassword:     "Dbpass12345678",
+		DatabaseRootPassword: "Rootpass1234567",
+	}
+	if got := credentialsFromSecret(secret); *got != want {
+		t.Fatalf("secret holds %+v, want the release's passwords %+v", *got, want)
+	}
+}
+
+func TestEnsureCredentialsGeneratesOnlyOnFirstInstall(t *testing.T) {
+	p, client := newFakeHelmProvisioner()
+	store := models.Store{ID: "s1", Type: "woocommerce", Namespace: "store-s1"}
+	ctx := context.Background()
+
+	// A release that neither has the Secret nor knows its passwords can't be given new ones
+	err := p.ensureCredentials(ctx, store, map[string]interface{}{"storeId": "s1"}, nil)
+	if !errors.Is(err, ErrCredentialsNotFound) {
+		t.Fatalf("ensureCredentials for a release without passwords = %v, want %v", err, ErrCredentialsNotFound)
+	}
+	if _, err := client.CoreV1().Secrets(store.Namespace).Get(ctx, CredentialsSecretName, metav1.GetOptions{}); err == nil {
+		t.Fatal("created a secret for a release without passwords")
+	}
+
+	if err := p.ensureCredentials(ctx, store, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	first, err := p.Credentials(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.AdminPassword == "" || first.DatabasePassword == "" || first.DatabaseRootPassword == "" {
+		t.Fatalf("first install generated incomplete credentials %+v", *first)
+	}
+
+	// Later upgrades keep the Secret as it is
+	if err := p.ensureCredentials(ctx, store, map[string]interface{}{"storeId": "s1"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := p.Credentials(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *kept != *first {
+		t.Fatalf("upgrade replaced the credentials %+v with %+v", *first, *kept)
+	}
+}
+
+func TestSimulatedRotateCredentialsDuringUpgrade(t *testing.T) {
+	p := NewSimulatedProvisioner(SimulationConfig{Latency: 5 * time.Millisecond, Timeout: time.Second})
+	store := models.Store{ID: "s1", Type: "woocommerce", Namespace: "store-s1"}
+	ctx := context.Background()
+	if err := p.Install(ctx, store, nil); err != nil {
+		t.Fatal(err)
+	}
+	before, err := p.Credentials(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The upgrade changes the release while the rotation looks at it; either
+	// may see the other's work, but run with -race neither may race on it
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := p.Upgrade(ctx, store, nil); err != nil {
+			t.Error(err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		p.RotateCredentials(ctx, store, nil)
+	}()
+	wg.Wait()
+
+	after, err := p.Credentials(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.AdminUsername != before.AdminUsername {
+		t.Fatalf("rotation changed the admin username from %q to %q", before.AdminUsername, after.AdminUsername)
+	}
+}
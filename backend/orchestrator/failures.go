@@ -0,0 +1,147 @@
+package orchestrator
+
+import (
+	"errors"
+	"strings"
+	"urumi-backend/redact"
+)
+
+// Failure codes an install error is sorted into
+const (
+	FailureImagePull       = "ImagePullBackOff"
+	FailureQuotaExceeded   = "QuotaExceeded"
+	FailureIngressConflict = "IngressConflict"
+	FailureTimeout         = "Timeout"
+	FailureStorageUnbound  = "StorageUnbound"
+	FailureChartNotFound   = "ChartNotFound"
+	FailureUnknown         = "Unknown"
+	// FailureUninstall is used for deletions, which are not classified further
+	FailureUninstall = "UninstallFailed"
+	// FailureUnhealthy is used when a store fails its health check after a rollback
+	FailureUnhealthy = "HealthCheckFailed"
+)
+
+// Failure is a classified provisioning error with a remediation hint for the user
+type Failure struct {
+	Code string `json:"code"`
+	Hint string `json:"hint"`
+}
+
+// failureRule maps fragments of helm errors and namespace events to a failure code
+type failureRule struct {
+	code      string
+	hint      string
+	fragments []string
+}
+
+// failureRules are checked in order; the more specific causes come before the
+// generic timeout that helm reports for most of them
+var failureRules = []failureRule{
+	{
+		code:      FailureChartNotFound,
+		hint:      "The chart for this store type is missing from the charts directory. Check CHARTS_DIR and the store type, then retry.",
+		fragments: []string{ErrChartNotFound.Error()},
+	},
+	{
+		code:      FailureQuotaExceeded,
+		hint:      "The store namespace ran out of its resource quota. Raise the quota or pick a smaller plan, then retry.",
+		fragments: []string{"exceeded quota", "forbidden: failed quota"},
+	},
+	{
+		code:      FailureIngressConflict,
+		hint:      "Another ingress already serves this host and path. Remove the conflicting ingress or change DOMAIN_SUFFIX, then retry.",
+		fragments: []string{"is already defined in ingress", "host already exists", "denied the request: host"},
+	},
+	{
+		code:      FailureImagePull,
+		hint:      "An image could not be pulled. Check the image name and tag in the chart values, registry credentials and the cluster's network access.",
+		fragments: []string{"ImagePullBackOff", "ErrImagePull", "Back-off pulling image", "manifest unknown"},
+	},
+	{
+		code:      FailureStorageUnbound,
+		hint:      "A PersistentVolumeClaim was never bound. Make sure the cluster has a default StorageClass with free capacity.",
+		fragments: []string{"unbound immediate PersistentVolumeClaims", "pod has unbound", "no persistent volumes available", "waiting for a volume to be created"},
+	},
+	{
+		code:      FailureTimeout,
+		hint:      "The store's pods did not become ready in time. Check the install log for the pods that were not ready; retrying often helps on a busy cluster.",
+		fragments: []string{"timed out waiting for the condition", "context deadline exceeded"},
+	},
+}
+
+// unknownFailureHint is shown for errors that match no rule
+const unknownFailureHint = "The install failed for an unrecognised reason. Download the install log for the full output."
+
+// ClassifyFailure sorts an install error into the failure taxonomy. output is
+// the attempt's log, whose namespace events often name the real cause of a
+// helm timeout.
+func ClassifyFailure(err error, output string) Failure {
+	if errors.Is(err, ErrChartNotFound) {
+		return Failure{Code: FailureChartNotFound, Hint: failureRules[0].hint}
+	}
+	text := output
+	if err != nil {
+		text = err.Error() + "\n" + output
+	}
+	for _, rule := range failureRules {
+		for _, fragment := range rule.fragments {
+			if strings.Contains(text, fragment) {
+				return Failure{Code: rule.code, Hint: rule.hint}
+			}
+		}
+	}
+	return Failure{Code: FailureUnknown, Hint: unknownFailureHint}
+}
+
+// unhealthyFailure is reported when a rolled back store does not pass its health check
+var unhealthyFailure = Failure{
+	Code: FailureUnhealthy,
+	Hint: "The release was rolled back but the store is not responding. Check the store's conditions and events, or roll back to another revision.",
+}
+
+// uninstallFailure is reported for every failed deletion
+var uninstallFailure = Failure{
+	Code: FailureUninstall,
+	Hint: "Removing the release or namespace failed. Check for finalizers that block the namespace deletion, then retry the deletion.",
+}
+
+// ProvisionError is a provisioning failure together with its classification
+type ProvisionError struct {
+	Failure Failure
+	Err     error
+}
+
+func (e *ProvisionError) Error() string { return e.Err.Error() }
+
+func (e *ProvisionError) Unwrap() error { return e.Err }
+
+// classify returns the failure an error was sorted into, classifying it from
+// the error text alone if that did not happen yet
+func classify(err error) Failure {
+	var provisionErr *ProvisionError
+	if errors.As(err, &provisionErr) {
+		return provisionErr.Failure
+	}
+	return ClassifyFailure(err, "")
+}
+
+// failureColumns are the store columns that describe a failure: the raw
+// error for operators, redacted, and the code and hint that the API returns
+func failureColumns(err error) map[string]interface{} {
+	failure := classify(err)
+	message := redact.Error(err)
+	return map[string]interface{}{
+		"error_message": &message,
+		"error_code":    failure.Code,
+		"error_hint":    failure.Hint,
+	}
+}
+
+// clearedFailureColumns reset the failure columns of a store
+func clearedFailureColumns() map[string]interface{} {
+	return map[string]interface{}{
+		"error_message": nil,
+		"error_code":    "",
+		"error_hint":    "",
+	}
+}
@@ -0,0 +1,79 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		output string
+		want   string
+	}{
+		{"chart missing", fmt.Errorf("woocommerce: %w", ErrChartNotFound), "", FailureChartNotFound},
+		{"chart missing wins over timeout", fmt.Errorf("%w: timed out waiting for the condition", ErrChartNotFound), "", FailureChartNotFound},
+		{"chart missing in text", errors.New("helm install failed: chart not found"), "", FailureChartNotFound},
+		{"quota", errors.New(`pods "store-1-app-0" is forbidden: exceeded quota: store-1`), "", FailureQuotaExceeded},
+		{"quota admission", errors.New("admission webhook: forbidden: failed quota: store-1"), "", FailureQuotaExceeded},
+		{"ingress host taken", errors.New(`host "shop.localhost" and path "/" is already defined in ingress store-2/store`), "", FailureIngressConflict},
+		{"ingress webhook", errors.New(`admission webhook "validate.nginx.ingress.kubernetes.io" denied the request: host "shop.localhost" already exists`), "", FailureIngressConflict},
+		{"image pull backoff", errors.New("pod store-1-app-0: ImagePullBackOff"), "", FailureImagePull},
+		{"image pull error", errors.New("ErrImagePull"), "", FailureImagePull},
+		{"image tag missing", errors.New("docker.io/library/wordpress:9.9: manifest unknown"), "", FailureImagePull},
+		{"unbound claims", errors.New("0/1 nodes are available: pod has unbound immediate PersistentVolumeClaims"), "", FailureStorageUnbound},
+		{"no volumes", errors.New("no persistent volumes available for this claim"), "", FailureStorageUnbound},
+		{"provisioning volume", errors.New(`waiting for a volume to be created, either by external provisioner "rancher.io/local-path"`), "", FailureStorageUnbound},
+		{"helm timeout", errors.New("timed out waiting for the condition"), "", FailureTimeout},
+		{"context deadline", errors.New("context deadline exceeded"), "", FailureTimeout},
+		// helm only reports the timeout; the namespace events in the log name the cause
+		{"timeout caused by image pull", errors.New("timed out waiting for the condition"), "Event Warning Failed Pod/store-1-app-0: Back-off pulling image \"wordpress:9.9\"", FailureImagePull},
+		{"timeout caused by quota", errors.New("context deadline exceeded"), "Event Warning FailedCreate StatefulSet/store-1-app: exceeded quota", FailureQuotaExceeded},
+		{"output only", nil, "Event Warning FailedScheduling Pod/store-1-db-0: pod has unbound immediate PersistentVolumeClaims", FailureStorageUnbound},
+		{"unrecognised", errors.New("connection refused"), "Installing release store-1", FailureUnknown},
+		{"nothing to go on", nil, "", FailureUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := ClassifyFailure(tt.err, tt.output)
+			if failure.Code != tt.want {
+				t.Fatalf("ClassifyFailure = %s, want %s", failure.Code, tt.want)
+			}
+			if failure.Hint == "" {
+				t.Fatalf("%s has no hint", failure.Code)
+			}
+		})
+	}
+}
+
+func TestClassifyFailureCoversEveryRule(t *testing.T) {
+	for _, rule := range failureRules {
+		for _, fragment := range rule.fragments {
+			if got := ClassifyFailure(errors.New("install failed: "+fragment), "").Code; got != rule.code {
+				t.Errorf("fragment %q classified as %s, want %s", fragment, got, rule.code)
+			}
+		}
+	}
+	if got := ClassifyFailure(errors.New("something else"), ""); got.Code != FailureUnknown || got.Hint != unknownFailureHint {
+		t.Errorf("fallback = %+v, want %s", got, FailureUnknown)
+	}
+}
+
+func TestFailureColumnsRedactCredentials(t *testing.T) {
+	err := fmt.Errorf("helm install failed: %w", errors.New(
+		"exec: helm upgrade --install store-1 --set mariadb.auth.rootPassword=Rt5ecretXyz --set wordpress.db.password=Db5ecretXyz: timed out waiting for the condition"))
+
+	columns := failureColumns(err)
+	message := *columns["error_message"].(*string)
+	for _, secret := range []string{"Rt5ecretXyz", "Db5ecretXyz"} {
+		if strings.Contains(message, secret) {
+			t.Errorf("error_message %q contains %s", message, secret)
+		}
+	}
+	if columns["error_code"] != FailureTimeout {
+		t.Errorf("error_code = %v, want %s", columns["error_code"], FailureTimeout)
+	}
+}
@@ -0,0 +1,35 @@
+package orchestrator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"urumi-backend/models"
+)
+
+func TestCheckStoreHealthStopsWithContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	withStoreTypes(t, StoreType{Name: "medusa", HealthCheckPath: "/health"})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	healthy, err := CheckStoreHealth(ctx, models.Store{ID: "s1", Type: "medusa", URL: server.URL})
+	if healthy || err == nil {
+		t.Fatalf("CheckStoreHealth = %t, %v; want an error", healthy, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("CheckStoreHealth took %s after its context expired", elapsed)
+	}
+}
@@ -1,167 +1,522 @@
 package orchestrator
 
 import (
-	"crypto/rand"
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"math/big"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 	"urumi-backend/models"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"helm.sh/helm/v3/pkg/strvals"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
 )
 
-// ProvisionStore runs the helm install command
-func ProvisionStore(store models.Store) error {
-	// Helm install command
-	// helm install <release-name> ../charts/woocommerce --namespace <ns> --create-namespace --set ...
-
-	// Determine chart based on store type
-	var chartPath string
-	
-	// Resolve chart directory relative to current working directory or executable
-	baseDir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get current working directory: %w", err)
-	}
-	
-	// Check if running from root or backend
-	if _, err := os.Stat(filepath.Join(baseDir, "charts")); err == nil {
-		// Running from root
-		chartPath = filepath.Join(baseDir, "charts")
-	} else if _, err := os.Stat(filepath.Join(baseDir, "../charts")); err == nil {
-		// Running from backend
-		chartPath = filepath.Join(baseDir, "../charts")
-	} else {
-		// Fallback to Env var or assume relative
-		chartPath = os.Getenv("CHARTS_DIR")
-		if chartPath == "" {
-			return fmt.Errorf("could not locate charts directory")
+// helmTimeout bounds how long an install or upgrade waits for resources to become ready
+const helmTimeout = 10 * time.Minute
+
+// HelmProvisioner provisions stores with the Helm SDK and client-go
+type HelmProvisioner struct {
+	settings *cli.EnvSettings
+
+	clientOnce sync.Once
+	client     kubernetes.Interface
+	clientErr  error
+}
+
+// NewHelmProvisioner creates a provisioner that talks to the cluster in $KUBECONFIG
+func NewHelmProvisioner() *HelmProvisioner {
+	settings := cli.New()
+	settings.KubeConfig = kubeconfigPath()
+	return &HelmProvisioner{settings: settings}
+}
+
+// actionConfig builds a Helm action configuration scoped to a store namespace.
+// Helm's debug output, which includes its progress while waiting for resources, also goes to logf.
+func (p *HelmProvisioner) actionConfig(store models.Store, logf LogFunc) (*action.Configuration, error) {
+	cfg := new(action.Configuration)
+	debug := func(format string, v ...interface{}) {
+		log.Printf("[helm] store %s: %s", store.ID, fmt.Sprintf(format, v...))
+		logf.printf(format, v...)
+	}
+	if err := cfg.Init(p.settings.RESTClientGetter(), store.Namespace, os.Getenv("HELM_DRIVER"), debug); err != nil {
+		return nil, fmt.Errorf("failed to initialise helm for namespace %s: %w", store.Namespace, err)
+	}
+	return cfg, nil
+}
+
+// kubeClient lazily creates the Kubernetes clientset so the backend can start without a reachable cluster
+func (p *HelmProvisioner) kubeClient() (kubernetes.Interface, error) {
+	p.clientOnce.Do(func() {
+		restConfig, err := p.settings.RESTClientGetter().ToRESTConfig()
+		if err != nil {
+			p.clientErr = fmt.Errorf("failed to load kubeconfig: %w", err)
+			return
 		}
+		p.client, p.clientErr = kubernetes.NewForConfig(restConfig)
+	})
+	return p.client, p.clientErr
+}
+
+// loadChart resolves the chart for the store type and computes its values
+func (p *HelmProvisioner) loadChart(store models.Store) (*chart.Chart, map[string]interface{}, error) {
+	storeType, err := LookupStoreType(store.Type)
+	if err != nil {
+		return nil, nil, err
 	}
+	specificChartPath := storeType.chartPath(storeTypes.dir)
 
-	kubeconfig := os.Getenv("KUBECONFIG")
-	if kubeconfig == "" {
-		home, _ := os.UserHomeDir()
-		kubeconfig = filepath.Join(home, ".kube", "config")
+	// Values File Logic: HELM_VALUES_FILE, else the store type's file for this environment
+	valuesFile := os.Getenv("HELM_VALUES_FILE")
+	if file, ok := storeType.ValuesFiles[storeEnvironment()]; ok && valuesFile == "" {
+		valuesFile = filepath.Join(specificChartPath, file)
 	}
 
-	// Domain Suffix Logic
-	domainSuffix := os.Getenv("DOMAIN_SUFFIX")
-	if domainSuffix == "" {
-		domainSuffix = "localhost" // Default for local dev
+	chrt, err := loader.Load(specificChartPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrChartNotFound, specificChartPath)
+		}
+		return nil, nil, fmt.Errorf("failed to load chart %s: %w", specificChartPath, err)
+	}
+	if deps := chrt.Metadata.Dependencies; deps != nil {
+		if err := action.CheckDependencies(chrt, deps); err != nil {
+			return nil, nil, fmt.Errorf("chart %s has missing dependencies (run `helm dependency build`): %w", specificChartPath, err)
+		}
+	}
+	if storeType.Chart.Version != "" {
+		if err := checkChartVersion(chrt.Metadata.Version, storeType.Chart.Version); err != nil {
+			return nil, nil, fmt.Errorf("chart %s: %w", specificChartPath, err)
+		}
 	}
 
-	// Values File Logic
-	valuesFile := os.Getenv("HELM_VALUES_FILE")
-	
-	var specificChartPath string
-
-	switch store.Type {
-	case "medusa":
-		specificChartPath = filepath.Join(chartPath, "medusa")
-		if valuesFile == "" {
-			valuesFile = filepath.Join(specificChartPath, "values-local.yaml")
+	// Without a values file for this environment the chart's own defaults apply
+	vals := map[string]interface{}{}
+	if valuesFile != "" {
+		if vals, err = chartutil.ReadValuesFile(valuesFile); err != nil {
+			return nil, nil, fmt.Errorf("failed to read values file %s: %w", valuesFile, err)
 		}
-	default:
-		specificChartPath = filepath.Join(chartPath, "woocommerce")
-		if valuesFile == "" {
-			valuesFile = filepath.Join(specificChartPath, "values-local.yaml")
+	}
+
+	// The store's plan and desired spec go first, so they can never override what the orchestrator owns
+	if err := applyPlan(store, vals); err != nil {
+		return nil, nil, err
+	}
+	applySpec(store, vals)
+
+	// Host generation: store-uuid.domain or just store-uuid for simple setups
+	// If domainSuffix is "localhost", we might want store-uuid.localhost
+	host := fmt.Sprintf("%s.%s", store.Namespace, domainSuffix())
+
+	overrides := []string{
+		fmt.Sprintf("storeId=%s", store.ID),
+		fmt.Sprintf("mariadb.commonLabels.%s=%s", strings.ReplaceAll(StoreIDLabel, ".", `\.`), store.ID),
+		fmt.Sprintf("ingress.hosts[0].host=%s", host),
+		// Passwords are read from the credentials Secret, never passed as values
+		fmt.Sprintf("credentials.secretName=%s", CredentialsSecretName),
+		fmt.Sprintf("mariadb.auth.existingSecret=%s", CredentialsSecretName),
+	}
+	for _, set := range overrides {
+		if err := strvals.ParseIntoString(set, vals); err != nil {
+			return nil, nil, fmt.Errorf("failed to apply chart override: %w", err)
 		}
 	}
 
+	return chrt, vals, nil
+}
+
+// Install runs the equivalent of `helm upgrade --install` for the store
+func (p *HelmProvisioner) Install(ctx context.Context, store models.Store, logf LogFunc) error {
+	cfg, err := p.actionConfig(store, logf)
+	if err != nil {
+		return err
+	}
+	chrt, vals, err := p.loadChart(store)
+	if err != nil {
+		return err
+	}
+
 	releaseName := store.Namespace
 
-	// Generate secure random passwords
-	rootPass, err := generateSecurePassword(16)
+	history := action.NewHistory(cfg)
+	history.Max = 1
+	releases, err := history.Run(releaseName)
+	switch {
+	case err == nil && len(releases) > 0 && releases[len(releases)-1].Info.Status == release.StatusPendingInstall:
+		// Left behind by an interrupted install; jobs never run concurrently for a store, so nothing owns it
+		log.Printf("Release %s is stuck in pending-install, removing it before reinstalling store %s", releaseName, store.ID)
+		logf.printf("Release %s is stuck in pending-install, removing it before reinstalling", releaseName)
+		uninstall := action.NewUninstall(cfg)
+		uninstall.IgnoreNotFound = true
+		if _, err := uninstall.Run(releaseName); err != nil {
+			return fmt.Errorf("failed to remove release stuck in pending-install: %w", err)
+		}
+	case err == nil:
+		log.Printf("Release %s already exists, upgrading store %s", releaseName, store.ID)
+		logf.printf("Release %s already exists, upgrading it", releaseName)
+		if err := p.rollBackStuckUpgrade(ctx, cfg, store, releases, logf); err != nil {
+			return err
+		}
+		return p.upgrade(ctx, cfg, store, chrt, vals, logf)
+	case !errors.Is(err, driver.ErrReleaseNotFound):
+		return fmt.Errorf("failed to read release history: %w", err)
+	}
+
+	if err := p.ensureNamespace(ctx, store); err != nil {
+		return err
+	}
+	if err := p.ensureCredentials(ctx, store, nil, logf); err != nil {
+		return err
+	}
+
+	install := action.NewInstall(cfg)
+	install.ReleaseName = releaseName
+	install.Namespace = store.Namespace
+	install.Wait = true // Wait for resources to be ready
+	install.Timeout = helmTimeout
+
+	log.Printf("Installing release %s (chart %s) for store %s", releaseName, chrt.Name(), store.ID)
+	logf.printf("Installing release %s (chart %s %s) into namespace %s", releaseName, chrt.Name(), chrt.Metadata.Version, store.Namespace)
+	stopEvents := p.streamEvents(ctx, store, logf)
+	defer stopEvents()
+	if _, err := install.RunWithContext(ctx, chrt, vals); err != nil {
+		log.Printf("Error provision store %s: %v", store.ID, err)
+		return fmt.Errorf("helm install failed: %w", err)
+	}
+
+	log.Printf("Successfully provisioned store %s at %s", store.ID, store.URL)
+	return nil
+}
+
+// streamEvents writes the Kubernetes events of the store namespace to logf,
+// such as scheduling failures or image pull back-offs, until the returned
+// function is called
+func (p *HelmProvisioner) streamEvents(ctx context.Context, store models.Store, logf LogFunc) func() {
+	if logf == nil {
+		return func() {}
+	}
+	client, err := p.kubeClient()
 	if err != nil {
-		return fmt.Errorf("failed to generate root password: %w", err)
+		logf.printf("Not streaming cluster events: %v", err)
+		return func() {}
 	}
-	dbPass, err := generateSecurePassword(16)
+	ctx, cancel := context.WithCancel(ctx)
+	events, err := client.CoreV1().Events(store.Namespace).Watch(ctx, metav1.ListOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to generate database password: %w", err)
+		cancel()
+		logf.printf("Not streaming cluster events: %v", err)
+		return func() {}
 	}
-	// For demo purposes, we set a known admin password so the user can login
-	wpInternalPass := "password123"
 
-	// Host generation: store-uuid.domain or just store-uuid for simple setups
-	// If domainSuffix is "localhost", we might want store-uuid.localhost
-	host := fmt.Sprintf("%s.%s", store.Namespace, domainSuffix)
-
-	cmd := exec.Command("helm", "upgrade", "--install", releaseName, specificChartPath,
-		"--kubeconfig", kubeconfig,
-		"--namespace", store.Namespace,
-		"--create-namespace",
-		"--values", valuesFile,
-		"--set", fmt.Sprintf("ingress.hosts[0].host=%s", host),
-		"--set", fmt.Sprintf("mariadb.auth.rootPassword=%s", rootPass),
-		"--set", fmt.Sprintf("mariadb.auth.password=%s", dbPass),
-		"--set", fmt.Sprintf("wordpress.db.password=%s", dbPass), // DB Connection pass
-		"--set", fmt.Sprintf("wordpress.password=%s", wpInternalPass), // Admin Panel pass
-		"--wait", // Wait for resources to be ready (optional, might timeout long operations)
-		"--timeout", "10m",
-	)
-
-	log.Printf("Executing helm command for store %s: %s", store.ID, cmd.String())
-	
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Error provision store %s: %v\nOutput: %s", store.ID, err, string(output))
-		return fmt.Errorf("helm install failed: %w - Output: %s", err, string(output))
-	}
-	
-	log.Printf("Successfully provisioned store %s at %s\nOutput: %s", store.ID, host, string(output))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer events.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-events.ResultChan():
+				if !ok {
+					return
+				}
+				event, ok := e.Object.(*corev1.Event)
+				if !ok || e.Type == watch.Deleted {
+					continue
+				}
+				logf.printf("Event %s %s %s/%s: %s", event.Type, event.Reason, event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Message)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// ensureNamespace creates the store namespace labelled with the store ID so it can be watched
+func (p *HelmProvisioner) ensureNamespace(ctx context.Context, store models.Store) error {
+	client, err := p.kubeClient()
+	if err != nil {
+		return err
+	}
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   store.Namespace,
+			Labels: map[string]string{StoreIDLabel: store.ID},
+		},
+	}
+	if _, err := client.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create namespace %s: %w", store.Namespace, err)
+	}
 	return nil
 }
 
-func generateSecurePassword(length int) (string, error) {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789" // Removed special chars to avoid shell escaping issues
-	b := make([]byte, length)
-	for i := range b {
-		num, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
-		if err != nil {
-			return "", err
+// Upgrade re-applies the chart to the store's existing release
+func (p *HelmProvisioner) Upgrade(ctx context.Context, store models.Store, logf LogFunc) error {
+	cfg, err := p.actionConfig(store, logf)
+	if err != nil {
+		return err
+	}
+	chrt, vals, err := p.loadChart(store)
+	if err != nil {
+		return err
+	}
+
+	releaseName := store.Namespace
+	history := action.NewHistory(cfg)
+	history.Max = 1
+	releases, err := history.Run(releaseName)
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return fmt.Errorf("failed to read release history: %w", err)
+	}
+	if err == nil {
+		if err := p.rollBackStuckUpgrade(ctx, cfg, store, releases, logf); err != nil {
+			return err
 		}
-		b[i] = charset[num.Int64()]
 	}
-	return string(b), nil
+	return p.upgrade(ctx, cfg, store, chrt, vals, logf)
 }
 
-// DeleteStore runs the helm uninstall command
-func DeleteStore(store models.Store) error {
-	// Get KUBECONFIG
-	kubeconfig := os.Getenv("KUBECONFIG")
-	if kubeconfig == "" {
-		home, _ := os.UserHomeDir()
-		kubeconfig = filepath.Join(home, ".kube", "config")
+// rollBackStuckUpgrade rolls back a release left in pending-upgrade or
+// pending-rollback by an interrupted job, given its latest history entry;
+// helm refuses to upgrade the release until it is rolled back
+func (p *HelmProvisioner) rollBackStuckUpgrade(ctx context.Context, cfg *action.Configuration, store models.Store, releases []*release.Release, logf LogFunc) error {
+	if len(releases) == 0 {
+		return nil
+	}
+	status := releases[len(releases)-1].Info.Status
+	if status != release.StatusPendingUpgrade && status != release.StatusPendingRollback {
+		return nil
+	}
+	log.Printf("Release %s is stuck in %s, rolling it back before upgrading store %s", store.Namespace, status, store.ID)
+	logf.printf("Release %s is stuck in %s, rolling it back before upgrading", store.Namespace, status)
+	if err := p.rollbackTo(ctx, cfg, store, 0); err != nil {
+		return fmt.Errorf("failed to roll back release stuck in %s: %w", status, err)
+	}
+	return nil
+}
+
+func (p *HelmProvisioner) upgrade(ctx context.Context, cfg *action.Configuration, store models.Store, chrt *chart.Chart, vals map[string]interface{}, logf LogFunc) error {
+	upgrade := action.NewUpgrade(cfg)
+	upgrade.Namespace = store.Namespace
+	upgrade.Wait = true
+	upgrade.Timeout = helmTimeout
+
+	// Stores installed before the credentials Secret existed kept their passwords in the release values
+	released, err := action.NewGetValues(cfg).Run(store.Namespace)
+	if err != nil {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return fmt.Errorf("helm upgrade failed: %w", ErrReleaseNotFound)
+		}
+		return fmt.Errorf("failed to read release values: %w", err)
+	}
+	if released == nil {
+		released = map[string]interface{}{}
+	}
+	if err := p.ensureCredentials(ctx, store, released, logf); err != nil {
+		return err
 	}
+	if err := p.resizeVolumes(ctx, store, vals, logf); err != nil {
+		return err
+	}
+	logf.printf("Upgrading release %s (chart %s %s)", store.Namespace, chrt.Name(), chrt.Metadata.Version)
+	stopEvents := p.streamEvents(ctx, store, logf)
+	defer stopEvents()
+	if _, err := upgrade.RunWithContext(ctx, store.Namespace, chrt, vals); err != nil {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return fmt.Errorf("helm upgrade failed: %w", ErrReleaseNotFound)
+		}
+		log.Printf("Error upgrading store %s: %v", store.ID, err)
+		return fmt.Errorf("helm upgrade failed: %w", err)
+	}
+
+	log.Printf("Successfully upgraded store %s", store.ID)
+	return nil
+}
 
+// Uninstall removes the store's release and deletes its namespace
+func (p *HelmProvisioner) Uninstall(ctx context.Context, store models.Store) error {
 	log.Printf("Starting deletion of store %s (%s)", store.ID, store.Name)
 
 	// First, try to uninstall the helm release
-	cmd := exec.Command("helm", "uninstall", store.Namespace, "--namespace", store.Namespace, "--kubeconfig", kubeconfig)
-	log.Printf("Executing helm uninstall for store %s: %s", store.ID, cmd.String())
-	output, err := cmd.CombinedOutput()
+	cfg, err := p.actionConfig(store, nil)
 	if err != nil {
-		log.Printf("Error uninstalling helm release %s: %s\nOutput: %s\n", store.ID, err, string(output))
+		return err
+	}
+	uninstall := action.NewUninstall(cfg)
+	uninstall.IgnoreNotFound = true
+	if _, err := uninstall.Run(store.Namespace); err != nil {
+		log.Printf("Error uninstalling helm release %s: %v", store.ID, err)
 		// Continue to try deleting namespace anyway
 	} else {
 		log.Printf("Successfully uninstalled helm release for store %s", store.ID)
 	}
 
-	// Wait a moment for resources to be cleaned up
-	time.Sleep(2 * time.Second)
+	client, err := p.kubeClient()
+	if err != nil {
+		return err
+	}
+	// Read the credentials, including those of an unfinished rotation, before
+	// the namespace takes them along, to stop redacting them afterwards
+	var stored []*Credentials
+	if secret, err := client.CoreV1().Secrets(store.Namespace).Get(ctx, CredentialsSecretName, metav1.GetOptions{}); err == nil {
+		stored = append(stored, credentialsFromSecret(secret), credentialsFromData(secret.Data, pendingKeyPrefix))
+	}
 
-	// Delete the namespace
-	cmdNs := exec.Command("kubectl", "delete", "namespace", store.Namespace, "--kubeconfig", kubeconfig)
-	log.Printf("Executing kubectl delete namespace for store %s: %s", store.ID, cmdNs.String())
-	outputNs, errNs := cmdNs.CombinedOutput()
-	if errNs != nil {
-		log.Printf("Error deleting namespace %s: %s\nOutput: %s\n", store.Namespace, errNs, string(outputNs))
-		return fmt.Errorf("failed to delete namespace: %w", errNs)
+	// Delete the namespace and wait for it to be gone
+	namespaces := client.CoreV1().Namespaces()
+	if err := namespaces.Delete(ctx, store.Namespace, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("Error deleting namespace %s: %v", store.Namespace, err)
+		return fmt.Errorf("failed to delete namespace: %w", err)
+	}
+	err = wait.PollUntilContextTimeout(ctx, 2*time.Second, helmTimeout, true, func(ctx context.Context) (bool, error) {
+		_, err := namespaces.Get(ctx, store.Namespace, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed waiting for namespace %s to be deleted: %w", store.Namespace, err)
 	}
 
 	log.Printf("Successfully deleted namespace %s for store %s", store.Namespace, store.ID)
+	for _, creds := range stored {
+		creds.unregister()
+	}
 	return nil
 }
+
+// Status gets the release status and the readiness of the store's workloads from Kubernetes
+func (p *HelmProvisioner) Status(ctx context.Context, store models.Store) (*StoreStatus, error) {
+	client, err := p.kubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &StoreStatus{Phase: "Unknown"}
+	_, err = client.CoreV1().Namespaces().Get(ctx, store.Namespace, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return status, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to get namespace %s: %w", store.Namespace, err)
+	}
+	status.NamespaceExists = true
+
+	cfg, err := p.actionConfig(store, nil)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := action.NewStatus(cfg).Run(store.Namespace)
+	switch {
+	case errors.Is(err, driver.ErrReleaseNotFound):
+		// No release; leave Release empty
+	case err != nil:
+		return nil, fmt.Errorf("failed to get release status: %w", err)
+	default:
+		status.Release = rel.Info.Status.String()
+	}
+
+	// Readiness is computed from every workload in the namespace
+	components, err := componentReadiness(ctx, client, store.Namespace, store.Type)
+	if err != nil {
+		log.Printf("Failed to get workload status for %s: %v", store.Namespace, err)
+		return nil, err
+	}
+	status.Components = components
+	status.Phase = aggregatePhase(components)
+
+	if status.Ingresses, err = ingressStatuses(ctx, client, store.Namespace); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Resources lists the store's namespace, Helm release and the workloads, services,
+// ingresses and volume claims inside the namespace
+func (p *HelmProvisioner) Resources(ctx context.Context, store models.Store) ([]string, error) {
+	client, err := p.kubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.CoreV1().Namespaces().Get(ctx, store.Namespace, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to get namespace %s: %w", store.Namespace, err)
+	}
+	resources := []string{"Namespace/" + store.Namespace}
+
+	cfg, err := p.actionConfig(store, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := action.NewStatus(cfg).Run(store.Namespace); err == nil {
+		resources = append(resources, "HelmRelease/"+store.Namespace)
+	} else if !errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, fmt.Errorf("failed to get release status: %w", err)
+	}
+
+	ns := store.Namespace
+	deployments, err := client.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, d := range deployments.Items {
+		resources = append(resources, "Deployment/"+d.Name)
+	}
+	statefulSets, err := client.AppsV1().StatefulSets(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, s := range statefulSets.Items {
+		resources = append(resources, "StatefulSet/"+s.Name)
+	}
+	services, err := client.CoreV1().Services(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	for _, svc := range services.Items {
+		resources = append(resources, "Service/"+svc.Name)
+	}
+	ingresses, err := client.NetworkingV1().Ingresses(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+	for _, ing := range ingresses.Items {
+		resources = append(resources, "Ingress/"+ing.Name)
+	}
+	claims, err := client.CoreV1().PersistentVolumeClaims(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volume claims: %w", err)
+	}
+	for _, pvc := range claims.Items {
+		resources = append(resources, "PersistentVolumeClaim/"+pvc.Name)
+	}
+	return resources, nil
+}
+
+// CheckHealth probes the store's public URL
+func (p *HelmProvisioner) CheckHealth(ctx context.Context, store models.Store) (bool, error) {
+	return CheckStoreHealth(ctx, store)
+}
@@ -0,0 +1,665 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"urumi-backend/models"
+	"urumi-backend/redact"
+
+	"gorm.io/gorm"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// jobPollInterval is how often idle workers look for jobs they were not woken up for
+const jobPollInterval = 2 * time.Second
+
+// rollbackTimeout bounds how long removing the partial resources of a cancelled install may take
+const rollbackTimeout = helmTimeout
+
+// healthVerifyTimeout bounds how long a rolled back store may take to pass its health check
+const healthVerifyTimeout = 2 * time.Minute
+
+// healthVerifyInterval is how often the health of a rolled back store is checked
+const healthVerifyInterval = 5 * time.Second
+
+// errJobCancelled is returned by a job that stopped because it was cancelled
+var errJobCancelled = errors.New("job cancelled")
+
+// JobQueueConfig tunes the provisioning job queue
+type JobQueueConfig struct {
+	// Workers is the number of jobs that run at the same time.
+	Workers int
+	// Retry decides whether failed installs are retried automatically.
+	Retry RetryPolicy
+	// Atomic removes the release and namespace of an install that failed for
+	// good, unless the store asks to keep them for debugging.
+	Atomic bool
+}
+
+// JobQueueConfigFromEnv reads PROVISION_WORKERS, PROVISION_ATOMIC and the retry policy
+func JobQueueConfigFromEnv() (JobQueueConfig, error) {
+	config := JobQueueConfig{Workers: 2, Atomic: true}
+
+	if v := os.Getenv("PROVISION_WORKERS"); v != "" {
+		workers, err := strconv.Atoi(v)
+		if err != nil || workers < 1 {
+			return config, fmt.Errorf("invalid PROVISION_WORKERS %q: must be a positive integer", v)
+		}
+		config.Workers = workers
+	}
+	if v := os.Getenv("PROVISION_ATOMIC"); v != "" {
+		atomic, err := strconv.ParseBool(v)
+		if err != nil {
+			return config, fmt.Errorf("invalid PROVISION_ATOMIC %q: %w", v, err)
+		}
+		config.Atomic = atomic
+	}
+
+	retry, err := RetryPolicyFromEnv()
+	if err != nil {
+		return config, err
+	}
+	config.Retry = retry
+	return config, nil
+}
+
+// JobQueue runs persisted provisioning jobs on a bounded pool of workers.
+// Jobs survive restarts: anything left running by a previous process is picked up again.
+type JobQueue struct {
+	db     *gorm.DB
+	prov   Provisioner
+	config JobQueueConfig
+	wake   chan struct{}
+
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc // Job ID -> cancels the job's context
+}
+
+// NewJobQueue creates a queue that runs at most config.Workers jobs at a time
+func NewJobQueue(db *gorm.DB, prov Provisioner, config JobQueueConfig) *JobQueue {
+	return &JobQueue{
+		db:      db,
+		prov:    prov,
+		config:  config,
+		wake:    make(chan struct{}, config.Workers),
+		running: make(map[uint]context.CancelFunc),
+	}
+}
+
+// Wake tells an idle worker that a job was enqueued
+func (q *JobQueue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Abort cancels the context of a running job, which stops the helm operation
+// it is waiting on. It reports whether the job was running in this process.
+func (q *JobQueue) Abort(jobID uint) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cancel, ok := q.running[jobID]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// Run requeues interrupted jobs, recovers stores left in flight by a previous
+// process and starts the workers; it blocks until ctx is done
+func (q *JobQueue) Run(ctx context.Context) {
+	requeued, err := models.RequeueRunningJobs(q.db)
+	if err != nil {
+		log.Printf("Failed to requeue interrupted jobs: %v", err)
+	} else if requeued > 0 {
+		log.Printf("Requeued %d jobs interrupted by a restart", requeued)
+	}
+	q.recoverStores(ctx)
+
+	log.Printf("Starting %d provisioning workers (atomic installs: %t)", q.config.Workers, q.config.Atomic)
+	for i := 0; i < q.config.Workers; i++ {
+		go q.worker(ctx)
+	}
+	<-ctx.Done()
+}
+
+func (q *JobQueue) worker(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain everything runnable before going idle
+		for {
+			job, err := models.ClaimJob(q.db)
+			if err != nil {
+				log.Printf("Failed to claim job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			q.run(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// run executes one claimed job and records its outcome
+func (q *JobQueue) run(ctx context.Context, job *models.Job) {
+	log.Printf("Running %s job %d for store %s (attempt %d)", job.Type, job.ID, job.StoreID, job.Attempts)
+
+	ctx, cancel := context.WithCancel(ctx)
+	q.mu.Lock()
+	q.running[job.ID] = cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, job.ID)
+		q.mu.Unlock()
+		cancel()
+	}()
+
+	q.progress(job, models.PhaseStarting, 5)
+
+	var err error
+	var retryAt *time.Time
+	switch job.Type {
+	case models.JobInstall:
+		retryAt, err = q.install(ctx, job)
+	case models.JobUninstall:
+		err = q.uninstall(ctx, job)
+	case models.JobRotateCredentials:
+		err = q.rotateCredentials(ctx, job)
+	case models.JobUpgrade:
+		err = q.upgrade(ctx, job)
+	case models.JobRollback:
+		err = q.rollbackRelease(ctx, job)
+	default:
+		err = fmt.Errorf("unknown job type %q", job.Type)
+	}
+
+	if errors.Is(err, errJobCancelled) {
+		if cancelErr := models.CancelJob(q.db, job, "cancelled by user"); cancelErr != nil {
+			log.Printf("%v", cancelErr)
+		}
+		q.finishOperation(job, models.JobCancelled, "provisioning cancelled, partial resources removed", nil)
+		return
+	}
+	if err != nil {
+		log.Printf("Job %d for store %s failed: %v", job.ID, job.StoreID, err)
+	}
+	if retryAt != nil {
+		if retryErr := models.RetryJob(q.db, job, err, *retryAt); retryErr != nil {
+			log.Printf("%v", retryErr)
+		}
+		if opErr := models.UpdateOperationProgress(q.db, job.OperationID, models.JobPending, models.PhaseWaitingForRetry, 10); opErr != nil {
+			log.Printf("%v", opErr)
+		}
+		return
+	}
+	if finishErr := models.FinishJob(q.db, job, err); finishErr != nil {
+		log.Printf("%v", finishErr)
+	}
+	if err != nil {
+		q.finishOperation(job, models.JobFailed, "", err)
+		return
+	}
+	result := "store is ready"
+	switch job.Type {
+	case models.JobInstall:
+		// Once the job is finished no cancellation can be requested any more,
+		// so a flag still set now arrived while the install was completing
+		if q.cancelRequested(job) {
+			result = "store is ready, the install completed before it could be cancelled"
+			models.RecordEvent(q.db, job.StoreID, models.EventCancelTooLate, models.ActorProvisioner, "cancellation came too late", "helm install completed before the cancellation took effect")
+		}
+	case models.JobUninstall:
+		result = "store deleted"
+	case models.JobRotateCredentials:
+		result = "credentials rotated"
+	case models.JobUpgrade:
+		result = "store upgraded"
+	case models.JobRollback:
+		result = fmt.Sprintf("rolled back to revision %d, store is healthy", job.Revision)
+	}
+	q.finishOperation(job, models.JobSucceeded, result, nil)
+}
+
+// progress reports the phase a running job's operation has reached
+func (q *JobQueue) progress(job *models.Job, phase string, percent int) {
+	if err := models.UpdateOperationProgress(q.db, job.OperationID, models.JobRunning, phase, percent); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// finishOperation records the outcome of the operation a job carried out.
+// Classified failures are reported by their code and hint, not the raw error.
+func (q *JobQueue) finishOperation(job *models.Job, state, result string, jobErr error) {
+	var errorCode, errMessage string
+	var provisionErr *ProvisionError
+	switch {
+	case errors.As(jobErr, &provisionErr):
+		errorCode, errMessage = provisionErr.Failure.Code, provisionErr.Failure.Hint
+	case jobErr != nil:
+		errMessage = jobErr.Error()
+	}
+	if err := models.FinishOperation(q.db, job.OperationID, state, result, errorCode, errMessage); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// loadStore fetches the store a job belongs to
+func (q *JobQueue) loadStore(job *models.Job) (*models.Store, error) {
+	var store models.Store
+	if err := q.db.First(&store, "id = ?", job.StoreID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("store %s no longer exists", job.StoreID)
+		}
+		return nil, fmt.Errorf("failed to load store %s: %w", job.StoreID, err)
+	}
+	return &store, nil
+}
+
+// install deploys the store's release and moves it to Ready or Failed. Transient
+// failures leave the store Provisioning and return when the job should run again.
+func (q *JobQueue) install(ctx context.Context, job *models.Job) (*time.Time, error) {
+	s, err := q.loadStore(job)
+	if err != nil {
+		return nil, err
+	}
+	// Never recreate resources for a store the user started deleting
+	if s.Status != models.StatusProvisioning {
+		return nil, fmt.Errorf("store %s is %s, skipping install", s.ID, s.Status)
+	}
+	if job.CancelRequested {
+		return nil, q.rollback(job, s, nil)
+	}
+
+	if s, err = models.UpdateLatest(q.db, s.ID, models.StatusProvisioning, map[string]interface{}{
+		"provision_attempts": s.ProvisionAttempts + 1,
+		"next_retry_at":      nil,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record install attempt: %w", err)
+	}
+
+	log.Printf("Starting provisioning for store %s (%s), attempt %d", s.ID, s.Name, s.ProvisionAttempts)
+	q.progress(job, models.PhaseInstalling, 20)
+	models.RecordEvent(q.db, s.ID, models.EventInstallStarted, models.ActorProvisioner, "helm install started", fmt.Sprintf("job %d, attempt %d", job.ID, job.Attempts))
+	attempt, err := models.StartProvisionAttempt(q.db, job, s.ProvisionAttempts)
+	if err != nil {
+		// The install does not depend on its log
+		log.Printf("%v", err)
+	}
+	logf := q.attemptLog(attempt)
+	logf("Install attempt %d of store %s started (job %d, run %d)", s.ProvisionAttempts, s.Name, job.ID, job.Attempts)
+	err = q.prov.Install(ctx, *s, logf)
+	if err != nil && q.cancelRequested(job) {
+		logf("Install cancelled: %v", err)
+		q.finishAttempt(attempt, models.JobCancelled, Failure{})
+		return nil, q.rollback(job, s, err)
+	}
+	if err == nil {
+		logf("Install succeeded, store is ready at %s", s.URL)
+		q.finishAttempt(attempt, models.JobSucceeded, Failure{})
+		log.Printf("Successfully provisioned store %s", s.ID)
+		models.RecordEvent(q.db, s.ID, models.EventInstallSucceeded, models.ActorProvisioner, "helm install completed", "")
+		q.finishInstall(s.ID, models.StatusReady, "helm install completed", nil, nil)
+		return nil, nil
+	}
+
+	log.Printf("Failed to provision store %s: %v", s.ID, err)
+	logf("Install failed: %v", err)
+	failure := q.classifyAttempt(attempt, err)
+	logf("Failure classified as %s: %s", failure.Code, failure.Hint)
+	q.finishAttempt(attempt, models.JobFailed, failure)
+	err = &ProvisionError{Failure: failure, Err: err}
+	models.RecordEvent(q.db, s.ID, models.EventInstallFailed, models.ActorProvisioner, "helm install failed: "+failure.Code, failure.Hint)
+
+	if q.config.Retry.ShouldRetry(job.Attempts, err) {
+		retryAt := time.Now().Add(q.config.Retry.Delay(job.Attempts))
+		reason := fmt.Sprintf("helm install failed, retrying at %s (attempt %d of %d)", retryAt.Format(time.RFC3339), job.Attempts, q.config.Retry.MaxAttempts)
+		updates := failureColumns(err)
+		updates["status_reason"] = reason
+		updates["next_retry_at"] = retryAt
+		if _, updateErr := models.UpdateLatest(q.db, s.ID, models.StatusProvisioning, updates); updateErr != nil {
+			// The store moved on (e.g. it is being deleted), so don't retry
+			log.Printf("Failed to schedule retry for store %s: %v", s.ID, updateErr)
+			return nil, err
+		}
+		log.Printf("Retrying provisioning of store %s at %s", s.ID, retryAt.Format(time.RFC3339))
+		logf("Retrying at %s", retryAt.Format(time.RFC3339))
+		models.RecordEvent(q.db, s.ID, models.EventRetryScheduled, models.ActorProvisioner, reason, "")
+		return &retryAt, err
+	}
+
+	q.progress(job, models.PhaseCleaningUp, 80)
+	leftovers := q.cleanupFailedInstall(s)
+	q.finishInstall(s.ID, models.StatusFailed, "helm install failed: "+failure.Code, err, leftovers)
+	return nil, err
+}
+
+// attemptLog returns a LogFunc that appends to the attempt's persisted log
+func (q *JobQueue) attemptLog(attempt *models.ProvisionAttempt) LogFunc {
+	return func(format string, v ...interface{}) {
+		if attempt != nil {
+			models.AppendProvisionLog(q.db, attempt, fmt.Sprintf(format, v...))
+		}
+	}
+}
+
+// finishAttempt records the outcome of an install attempt, if it was recorded at all
+func (q *JobQueue) finishAttempt(attempt *models.ProvisionAttempt, state string, failure Failure) {
+	if attempt == nil {
+		return
+	}
+	if err := models.FinishProvisionAttempt(q.db, attempt, state, failure.Code, failure.Hint); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// classifyAttempt sorts a failed attempt into the failure taxonomy, using its
+// log as well as the error: helm only reports a timeout, while the namespace
+// events in the log usually name the cause
+func (q *JobQueue) classifyAttempt(attempt *models.ProvisionAttempt, err error) Failure {
+	if attempt == nil {
+		return ClassifyFailure(err, "")
+	}
+	output, logErr := models.ProvisionOutput(q.db, attempt)
+	if logErr != nil {
+		log.Printf("%v", logErr)
+	}
+	return ClassifyFailure(err, output)
+}
+
+// cleanupFailedInstall removes the release and namespace of an install that
+// failed for good, unless atomic installs are off or the store asked to keep
+// them for debugging. It returns the resources that are left in the cluster.
+func (q *JobQueue) cleanupFailedInstall(s *models.Store) models.StringList {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	if q.config.Atomic && !s.KeepOnFailure {
+		log.Printf("Cleaning up failed install of store %s", s.ID)
+		if err := q.prov.Uninstall(ctx, *s); err != nil {
+			log.Printf("Failed to clean up failed install of store %s: %v", s.ID, err)
+			models.RecordEvent(q.db, s.ID, models.EventCleanupFailed, models.ActorProvisioner, "removing partial resources failed", err.Error())
+		} else {
+			models.RecordEvent(q.db, s.ID, models.EventCleanedUp, models.ActorProvisioner, "partial resources removed", "release and namespace deleted")
+		}
+	}
+
+	leftovers, err := q.prov.Resources(ctx, *s)
+	if err != nil {
+		log.Printf("Failed to list leftover resources of store %s: %v", s.ID, err)
+		return models.StringList{"unknown: " + redact.Error(err)}
+	}
+	if len(leftovers) > 0 {
+		models.RecordEvent(q.db, s.ID, models.EventResourcesKept, models.ActorProvisioner, fmt.Sprintf("%d resources left in the cluster", len(leftovers)), strings.Join(leftovers, ", "))
+	}
+	return leftovers
+}
+
+// cancelRequested re-reads the job's cancellation flag
+func (q *JobQueue) cancelRequested(job *models.Job) bool {
+	var current models.Job
+	if err := q.db.First(&current, job.ID).Error; err != nil {
+		log.Printf("Failed to reload job %d: %v", job.ID, err)
+		return false
+	}
+	return current.CancelRequested
+}
+
+// rollback removes whatever a cancelled install left behind and moves the store
+// to Cancelled. If the cleanup fails the store is marked Failed instead.
+func (q *JobQueue) rollback(job *models.Job, s *models.Store, installErr error) error {
+	log.Printf("Provisioning of store %s cancelled, rolling back partial resources", s.ID)
+	q.progress(job, models.PhaseRollingBack, 80)
+	if installErr != nil {
+		models.RecordEvent(q.db, s.ID, models.EventInstallFailed, models.ActorProvisioner, "helm install aborted", installErr.Error())
+	}
+
+	// The job's own context is already cancelled, so the cleanup gets a fresh one
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+	if err := q.prov.Uninstall(ctx, *s); err != nil {
+		log.Printf("Failed to roll back cancelled store %s: %v", s.ID, err)
+		models.RecordEvent(q.db, s.ID, models.EventRollbackFailed, models.ActorProvisioner, "rolling back partial resources failed", err.Error())
+		leftovers, listErr := q.prov.Resources(ctx, *s)
+		if listErr != nil {
+			leftovers = []string{"unknown: " + redact.Error(listErr)}
+		}
+		err = &ProvisionError{Failure: uninstallFailure, Err: fmt.Errorf("rollback after cancellation failed: %w", err)}
+		q.finishInstall(s.ID, models.StatusFailed, "cancelled, but rolling back partial resources failed", err, leftovers)
+		return err
+	}
+
+	models.RecordEvent(q.db, s.ID, models.EventCancelled, models.ActorProvisioner, "provisioning cancelled", "release and namespace removed")
+	updates := clearedFailureColumns()
+	updates["next_retry_at"] = nil
+	updates["leftover_resources"] = models.StringList(nil)
+	if _, err := models.Transition(q.db, s.ID, models.StatusCancelled, "provisioning cancelled, partial resources removed", models.ActorProvisioner, updates); err != nil {
+		log.Printf("Failed to update store status for %s: %v", s.ID, err)
+	}
+	return errJobCancelled
+}
+
+// finishInstall moves the store to the outcome of its install and records what
+// the install left in the cluster. The store may have been deleted meanwhile;
+// the state machine rejects the outcome then.
+func (q *JobQueue) finishInstall(storeID, status, reason string, installErr error, leftovers models.StringList) {
+	updates := clearedFailureColumns()
+	if installErr != nil {
+		updates = failureColumns(installErr)
+	}
+	updates["leftover_resources"] = leftovers
+	if _, err := models.Transition(q.db, storeID, status, reason, models.ActorProvisioner, updates); err != nil {
+		log.Printf("Failed to update store status for %s: %v", storeID, err)
+	}
+}
+
+// uninstall removes the store's release and namespace, then the store record
+func (q *JobQueue) uninstall(ctx context.Context, job *models.Job) error {
+	s, err := q.loadStore(job)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Starting deletion for store %s (%s)", s.ID, s.Name)
+	q.progress(job, models.PhaseUninstalling, 20)
+	if err := q.prov.Uninstall(ctx, *s); err != nil {
+		log.Printf("Failed to delete store %s: %v", s.ID, err)
+		models.RecordEvent(q.db, s.ID, models.EventUninstallFailed, models.ActorProvisioner, "helm uninstall or namespace deletion failed", err.Error())
+		err = &ProvisionError{Failure: uninstallFailure, Err: err}
+		// Mark as failed deletion
+		if _, updateErr := models.Transition(q.db, s.ID, models.StatusDeletionFailed, "helm uninstall or namespace deletion failed", models.ActorProvisioner, failureColumns(err)); updateErr != nil {
+			log.Printf("Failed to update store status for %s: %v", s.ID, updateErr)
+		}
+		return err
+	}
+
+	log.Printf("Successfully deleted store %s", s.ID)
+	// Remove from database only after successful deletion; the events are kept
+	result := q.db.Where("status = ?", models.StatusDeleting).Delete(s)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete store record %s: %w", s.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		log.Printf("Store %s was no longer Deleting, keeping its record", s.ID)
+		return nil
+	}
+	models.RecordStoreChange(q.db, models.ChangeDeleted, s)
+	models.RecordEvent(q.db, s.ID, models.EventStoreDeleted, models.ActorProvisioner, "release and namespace removed", "")
+	return nil
+}
+
+// rotateCredentials replaces the passwords of a Ready store. The store stays
+// Ready throughout, its pods are restarted with a rolling restart.
+func (q *JobQueue) rotateCredentials(ctx context.Context, job *models.Job) error {
+	s, err := q.loadStore(job)
+	if err != nil {
+		return err
+	}
+	if s.Status != models.StatusReady {
+		return fmt.Errorf("store %s is %s, skipping credential rotation", s.ID, s.Status)
+	}
+
+	log.Printf("Rotating credentials of store %s (%s)", s.ID, s.Name)
+	q.progress(job, models.PhaseRotating, 20)
+	logf := func(format string, v ...interface{}) {
+		log.Printf("Credential rotation of store %s: %s", s.ID, fmt.Sprintf(format, v...))
+	}
+	if err := q.prov.RotateCredentials(ctx, *s, logf); err != nil {
+		log.Printf("Failed to rotate credentials of store %s: %v", s.ID, err)
+		models.RecordEvent(q.db, s.ID, models.EventRotationFailed, models.ActorProvisioner, "credential rotation failed", err.Error())
+		return err
+	}
+
+	if _, err := models.MarkCredentialsRotated(q.db, s.ID); err != nil {
+		log.Printf("Failed to record credential rotation of store %s: %v", s.ID, err)
+	}
+	models.RecordEvent(q.db, s.ID, models.EventRotated, models.ActorProvisioner, "credentials rotated", "new passwords applied and pods restarted")
+	log.Printf("Successfully rotated credentials of store %s", s.ID)
+	return nil
+}
+
+// upgrade applies the store's desired spec to its release with a helm upgrade.
+// The store keeps serving while the pods roll; a failed upgrade is recorded on
+// the store but leaves its status to the reconciler.
+func (q *JobQueue) upgrade(ctx context.Context, job *models.Job) error {
+	s, err := q.loadStore(job)
+	if err != nil {
+		return err
+	}
+	if s.Status != models.StatusReady && s.Status != models.StatusDegraded {
+		return fmt.Errorf("store %s is %s, skipping upgrade", s.ID, s.Status)
+	}
+
+	log.Printf("Upgrading store %s (%s)", s.ID, s.Name)
+	q.progress(job, models.PhaseUpgrading, 20)
+	models.RecordEvent(q.db, s.ID, models.EventUpgradeStarted, models.ActorProvisioner, "helm upgrade started", fmt.Sprintf("job %d", job.ID))
+	logf, output := capturedLog("Upgrade of store " + s.ID)
+	if err := q.prov.Upgrade(ctx, *s, logf); err != nil {
+		log.Printf("Failed to upgrade store %s: %v", s.ID, err)
+		failure := ClassifyFailure(err, output())
+		err = &ProvisionError{Failure: failure, Err: err}
+		models.RecordEvent(q.db, s.ID, models.EventUpgradeFailed, models.ActorProvisioner, "helm upgrade failed: "+failure.Code, failure.Hint)
+		if _, updateErr := models.UpdateColumns(q.db, s.ID, failureColumns(err)); updateErr != nil {
+			log.Printf("Failed to record upgrade failure of store %s: %v", s.ID, updateErr)
+		}
+		return err
+	}
+
+	if _, err := models.UpdateColumns(q.db, s.ID, clearedFailureColumns()); err != nil {
+		log.Printf("Failed to clear errors of store %s: %v", s.ID, err)
+	}
+	models.RecordEvent(q.db, s.ID, models.EventUpgradeSucceeded, models.ActorProvisioner, "helm upgrade completed", "")
+	log.Printf("Successfully upgraded store %s", s.ID)
+	return nil
+}
+
+// capturedLog returns a LogFunc that writes to the process log with the given
+// prefix and keeps the output, which the returned function reads, so that a
+// failure can be classified from it
+func capturedLog(prefix string) (LogFunc, func() string) {
+	// Cluster events are written from another goroutine
+	var mu sync.Mutex
+	var output strings.Builder
+	logf := func(format string, v ...interface{}) {
+		line := fmt.Sprintf(format, v...)
+		log.Printf("%s: %s", prefix, line)
+		mu.Lock()
+		output.WriteString(line + "\n")
+		mu.Unlock()
+	}
+	return logf, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return output.String()
+	}
+}
+
+// rollbackRelease rolls the store's release back to the job's revision, records
+// the spec of that revision as the store's desired spec and then waits for the
+// store to pass its health check
+func (q *JobQueue) rollbackRelease(ctx context.Context, job *models.Job) error {
+	s, err := q.loadStore(job)
+	if err != nil {
+		return err
+	}
+	if s.Status != models.StatusReady && s.Status != models.StatusDegraded {
+		return fmt.Errorf("store %s is %s, skipping rollback", s.ID, s.Status)
+	}
+
+	log.Printf("Rolling back store %s (%s) to revision %d", s.ID, s.Name, job.Revision)
+	q.progress(job, models.PhaseRollingBack, 20)
+	logf, output := capturedLog("Rollback of store " + s.ID)
+	if err := q.prov.Rollback(ctx, *s, job.Revision, logf); err != nil {
+		log.Printf("Failed to roll back store %s: %v", s.ID, err)
+		return q.rollbackFailed(s, &ProvisionError{Failure: ClassifyFailure(err, output()), Err: err})
+	}
+
+	// Without this the next upgrade would re-apply the spec that was rolled back
+	revisions, err := q.prov.Revisions(ctx, *s)
+	if err == nil {
+		var target *Revision
+		if target, err = findRevision(revisions, job.Revision); err == nil {
+			spec := map[string]interface{}{
+				"image_tag": target.ImageTag,
+				"values":    target.Values,
+			}
+			// Revisions deployed before plans existed don't record one
+			if target.Plan != "" {
+				spec["plan"] = target.Plan
+			}
+			_, err = models.UpdateColumns(q.db, s.ID, spec)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to restore the spec of revision %d for store %s: %v", job.Revision, s.ID, err)
+	}
+
+	q.progress(job, models.PhaseVerifyingHealth, 80)
+	var healthErr error
+	err = wait.PollUntilContextTimeout(ctx, healthVerifyInterval, healthVerifyTimeout, true, func(ctx context.Context) (bool, error) {
+		var healthy bool
+		healthy, healthErr = q.prov.CheckHealth(ctx, *s)
+		return healthy && healthErr == nil, nil
+	})
+	if err != nil {
+		if healthErr == nil {
+			healthErr = err
+		}
+		log.Printf("Store %s is not healthy after rolling back to revision %d: %v", s.ID, job.Revision, healthErr)
+		return q.rollbackFailed(s, &ProvisionError{Failure: unhealthyFailure, Err: fmt.Errorf("health check failed after rollback to revision %d: %w", job.Revision, healthErr)})
+	}
+
+	if _, err := models.UpdateColumns(q.db, s.ID, clearedFailureColumns()); err != nil {
+		log.Printf("Failed to clear errors of store %s: %v", s.ID, err)
+	}
+	models.RecordEvent(q.db, s.ID, models.EventReleaseRolledBack, models.ActorProvisioner, fmt.Sprintf("rolled back to revision %d", job.Revision), "health check passed")
+	log.Printf("Successfully rolled back store %s to revision %d", s.ID, job.Revision)
+	return nil
+}
+
+// rollbackFailed records a failed rollback on the store and returns err
+func (q *JobQueue) rollbackFailed(s *models.Store, err *ProvisionError) error {
+	models.RecordEvent(q.db, s.ID, models.EventReleaseRollbackFailed, models.ActorProvisioner, "rollback failed: "+err.Failure.Code, err.Failure.Hint)
+	if _, updateErr := models.UpdateColumns(q.db, s.ID, failureColumns(err)); updateErr != nil {
+		log.Printf("Failed to record rollback failure of store %s: %v", s.ID, updateErr)
+	}
+	return err
+}
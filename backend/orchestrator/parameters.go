@@ -0,0 +1,117 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"urumi-backend/models"
+)
+
+// Parameter is a chart value that users may set on their store. The catalog
+// lists each store type's parameters; everything else (host, credentials,
+// labels) is owned by the orchestrator.
+type Parameter struct {
+	Key         string `json:"key"`  // Dotted path in the chart values, e.g. wordpress.blogName
+	Type        string `json:"type"` // string, integer or boolean
+	Description string `json:"description"`
+}
+
+// imageTagPattern matches a valid container image tag
+var imageTagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// ValidateImageTag checks that tag can be used as a container image tag
+func ValidateImageTag(tag string) error {
+	if !imageTagPattern.MatchString(tag) {
+		return fmt.Errorf("invalid image tag %q", tag)
+	}
+	return nil
+}
+
+// ValidateValues checks that every value is a parameter of the store type with
+// the right type. Whole JSON numbers are converted to integers in place.
+func ValidateValues(storeType string, values map[string]interface{}) error {
+	t, err := LookupStoreType(storeType)
+	if err != nil {
+		return err
+	}
+	parameters := make(map[string]Parameter)
+	for _, parameter := range t.Parameters {
+		parameters[parameter.Key] = parameter
+	}
+
+	for key, value := range values {
+		parameter, ok := parameters[key]
+		if !ok && len(parameters) == 0 {
+			return fmt.Errorf("%s stores have no tunable values", storeType)
+		}
+		if !ok {
+			return fmt.Errorf("%s is not a tunable value of %s stores (allowed: %s)", key, storeType, strings.Join(parameterKeys(storeType), ", "))
+		}
+		if value == nil {
+			continue
+		}
+		switch parameter.Type {
+		case "string":
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("%s must be a string", key)
+			}
+		case "boolean":
+			if _, ok := value.(bool); !ok {
+				return fmt.Errorf("%s must be a boolean", key)
+			}
+		case "integer":
+			number, ok := value.(float64)
+			if !ok || number != math.Trunc(number) || number < 0 {
+				return fmt.Errorf("%s must be a non-negative integer", key)
+			}
+			values[key] = int64(number)
+		}
+	}
+	return nil
+}
+
+// parameterKeys returns the keys of the store type's parameters, sorted
+func parameterKeys(storeType string) []string {
+	var keys []string
+	t, _ := LookupStoreType(storeType)
+	for _, parameter := range t.Parameters {
+		keys = append(keys, parameter.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// applySpec sets the store's desired image tag and values in the chart values.
+// The spec itself is kept under storeSpec, so every release revision records
+// the spec it was deployed with and a rollback can restore it.
+func applySpec(store models.Store, vals map[string]interface{}) {
+	if store.ImageTag != "" {
+		setValue(vals, "image.tag", store.ImageTag)
+	}
+	spec := make(map[string]interface{}, len(store.Values))
+	for key, value := range store.Values {
+		setValue(vals, key, value)
+		spec[key] = value
+	}
+	vals[storeSpecKey] = map[string]interface{}{
+		"plan":     store.Plan,
+		"imageTag": store.ImageTag,
+		"values":   spec,
+	}
+}
+
+// setValue sets a value at a dotted path, creating the maps along the way
+func setValue(vals map[string]interface{}, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := vals[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			vals[key] = next
+		}
+		vals = next
+	}
+	vals[keys[len(keys)-1]] = value
+}
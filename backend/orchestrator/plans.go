@@ -0,0 +1,362 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"urumi-backend/models"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// ErrUnknownPlan is returned for a plan name that is not configured
+var ErrUnknownPlan = errors.New("unknown plan")
+
+// Plan is a named store size: the resources of the app and its database,
+// the sizes of their volumes and the ResourceQuota of the store namespace
+type Plan struct {
+	Name            string    `json:"name"`
+	Description     string    `json:"description,omitempty"`
+	App             Resources `json:"app"`
+	Database        Resources `json:"database"`
+	AppStorage      string    `json:"app_storage"`      // Size of the app's PersistentVolumeClaim
+	DatabaseStorage string    `json:"database_storage"` // Size of the MariaDB PersistentVolumeClaim
+	Quota           Quota     `json:"quota"`
+}
+
+// Resources are the requests and limits of a container
+type Resources struct {
+	Requests ResourceList `json:"requests"`
+	Limits   ResourceList `json:"limits"`
+}
+
+// ResourceList is an amount of CPU and memory, as Kubernetes quantities
+type ResourceList struct {
+	CPU    string `json:"cpu"`
+	Memory string `json:"memory"`
+}
+
+// Quota is the ResourceQuota of a store namespace. It has to leave room for
+// the sidecar and for the extra pod of a rolling update.
+type Quota struct {
+	Pods            string `json:"pods"`
+	RequestsCPU     string `json:"requests_cpu"`
+	RequestsMemory  string `json:"requests_memory"`
+	RequestsStorage string `json:"requests_storage"`
+	LimitsCPU       string `json:"limits_cpu"`
+	LimitsMemory    string `json:"limits_memory"`
+	PVCs            string `json:"pvcs"`
+}
+
+// PlanCatalog is the set of plans stores can be created with
+type PlanCatalog struct {
+	// Default is the plan clients offer first. Stores created without a plan
+	// get none, and run with their chart's own sizes.
+	Default string `json:"default"`
+	Plans   []Plan `json:"plans"`
+}
+
+// defaultPlans are used unless STORE_PLANS_FILE is set. "small" matches the
+// chart's own values.yaml.
+var defaultPlans = PlanCatalog{
+	Default: "small",
+	Plans: []Plan{
+		{
+			Name:            "dev",
+			Description:     "Development and demos",
+			App:             Resources{Requests: ResourceList{CPU: "100m", Memory: "128Mi"}, Limits: ResourceList{CPU: "250m", Memory: "256Mi"}},
+			Database:        Resources{Requests: ResourceList{CPU: "50m", Memory: "128Mi"}, Limits: ResourceList{CPU: "250m", Memory: "256Mi"}},
+			AppStorage:      "1Gi",
+			DatabaseStorage: "1Gi",
+			Quota:           Quota{Pods: "6", RequestsCPU: "500m", RequestsMemory: "1Gi", RequestsStorage: "3Gi", LimitsCPU: "2", LimitsMemory: "2Gi", PVCs: "3"},
+		},
+		{
+			Name:            "small",
+			Description:     "Small stores",
+			App:             Resources{Requests: ResourceList{CPU: "250m", Memory: "256Mi"}, Limits: ResourceList{CPU: "500m", Memory: "512Mi"}},
+			Database:        Resources{Requests: ResourceList{CPU: "100m", Memory: "128Mi"}, Limits: ResourceList{CPU: "250m", Memory: "256Mi"}},
+			AppStorage:      "1Gi",
+			DatabaseStorage: "1Gi",
+			Quota:           Quota{Pods: "10", RequestsCPU: "1", RequestsMemory: "1Gi", RequestsStorage: "5Gi", LimitsCPU: "2", LimitsMemory: "2Gi", PVCs: "5"},
+		},
+		{
+			Name:            "medium",
+			Description:     "Busy stores",
+			App:             Resources{Requests: ResourceList{CPU: "500m", Memory: "512Mi"}, Limits: ResourceList{CPU: "1", Memory: "1Gi"}},
+			Database:        Resources{Requests: ResourceList{CPU: "250m", Memory: "512Mi"}, Limits: ResourceList{CPU: "500m", Memory: "1Gi"}},
+			AppStorage:      "5Gi",
+			DatabaseStorage: "5Gi",
+			Quota:           Quota{Pods: "15", RequestsCPU: "2", RequestsMemory: "3Gi", RequestsStorage: "20Gi", LimitsCPU: "4", LimitsMemory: "5Gi", PVCs: "5"},
+		},
+		{
+			Name:            "large",
+			Description:     "High-traffic stores",
+			App:             Resources{Requests: ResourceList{CPU: "1", Memory: "1Gi"}, Limits: ResourceList{CPU: "2", Memory: "2Gi"}},
+			Database:        Resources{Requests: ResourceList{CPU: "500m", Memory: "1Gi"}, Limits: ResourceList{CPU: "1", Memory: "2Gi"}},
+			AppStorage:      "20Gi",
+			DatabaseStorage: "20Gi",
+			Quota:           Quota{Pods: "20", RequestsCPU: "4", RequestsMemory: "6Gi", RequestsStorage: "60Gi", LimitsCPU: "8", LimitsMemory: "10Gi", PVCs: "5"},
+		},
+	},
+}
+
+// plans is the catalog in use, set once at startup by ConfigurePlansFromEnv
+var plans = defaultPlans
+
+// ConfigurePlansFromEnv loads the plan catalog from the YAML or JSON file named
+// by STORE_PLANS_FILE. Without it the built-in plans are used.
+func ConfigurePlansFromEnv() error {
+	path := os.Getenv("STORE_PLANS_FILE")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read STORE_PLANS_FILE: %w", err)
+	}
+	var catalog PlanCatalog
+	if err := yaml.UnmarshalStrict(data, &catalog); err != nil {
+		return fmt.Errorf("invalid STORE_PLANS_FILE %s: %w", path, err)
+	}
+	if err := catalog.validate(); err != nil {
+		return fmt.Errorf("invalid STORE_PLANS_FILE %s: %w", path, err)
+	}
+	plans = catalog
+	return nil
+}
+
+// validate checks that every quantity parses and that each plan's quota fits
+// its app and database
+func (c PlanCatalog) validate() error {
+	if len(c.Plans) == 0 {
+		return errors.New("no plans defined")
+	}
+	seen := make(map[string]bool)
+	for _, plan := range c.Plans {
+		if plan.Name == "" {
+			return errors.New("plan without a name")
+		}
+		if seen[plan.Name] {
+			return fmt.Errorf("plan %s is defined twice", plan.Name)
+		}
+		seen[plan.Name] = true
+		if err := plan.validate(); err != nil {
+			return fmt.Errorf("plan %s: %w", plan.Name, err)
+		}
+	}
+	if !seen[c.Default] {
+		return fmt.Errorf("default plan %q is not defined", c.Default)
+	}
+	return nil
+}
+
+// Plan fields a store type maps to chart values in its plan_values
+const (
+	planFieldAppStorage      = "app_storage"
+	planFieldDatabaseStorage = "database_storage"
+)
+
+// fields returns the plan's quantities by field name, as store types refer to
+// them in plan_values
+func (p Plan) fields() map[string]string {
+	return map[string]string{
+		"app.requests.cpu":         p.App.Requests.CPU,
+		"app.requests.memory":      p.App.Requests.Memory,
+		"app.limits.cpu":           p.App.Limits.CPU,
+		"app.limits.memory":        p.App.Limits.Memory,
+		"database.requests.cpu":    p.Database.Requests.CPU,
+		"database.requests.memory": p.Database.Requests.Memory,
+		"database.limits.cpu":      p.Database.Limits.CPU,
+		"database.limits.memory":   p.Database.Limits.Memory,
+		planFieldAppStorage:        p.AppStorage,
+		planFieldDatabaseStorage:   p.DatabaseStorage,
+		"quota.pods":               p.Quota.Pods,
+		"quota.requests_cpu":       p.Quota.RequestsCPU,
+		"quota.requests_memory":    p.Quota.RequestsMemory,
+		"quota.requests_storage":   p.Quota.RequestsStorage,
+		"quota.limits_cpu":         p.Quota.LimitsCPU,
+		"quota.limits_memory":      p.Quota.LimitsMemory,
+		"quota.pvcs":               p.Quota.PVCs,
+	}
+}
+
+func (p Plan) validate() error {
+	for field, value := range p.fields() {
+		if _, err := resource.ParseQuantity(value); err != nil {
+			return fmt.Errorf("%s: invalid quantity %q", field, value)
+		}
+	}
+
+	// An app and database that don't fit the quota could never be scheduled
+	for _, check := range []struct {
+		name       string
+		quota      string
+		app, dbase string
+	}{
+		{"limits.cpu", p.Quota.LimitsCPU, p.App.Limits.CPU, p.Database.Limits.CPU},
+		{"limits.memory", p.Quota.LimitsMemory, p.App.Limits.Memory, p.Database.Limits.Memory},
+		{"requests.cpu", p.Quota.RequestsCPU, p.App.Requests.CPU, p.Database.Requests.CPU},
+		{"requests.memory", p.Quota.RequestsMemory, p.App.Requests.Memory, p.Database.Requests.Memory},
+		{"requests.storage", p.Quota.RequestsStorage, p.AppStorage, p.DatabaseStorage},
+	} {
+		need := resource.MustParse(check.app)
+		need.Add(resource.MustParse(check.dbase))
+		if quota := resource.MustParse(check.quota); quota.Cmp(need) < 0 {
+			return fmt.Errorf("quota %s %s is less than the %s the app and database need", check.name, check.quota, need.String())
+		}
+	}
+	return nil
+}
+
+// Plans returns the configured plans and the name of the default one
+func Plans() ([]Plan, string) {
+	return plans.Plans, plans.Default
+}
+
+// LookupPlan returns the named plan
+func LookupPlan(name string) (Plan, error) {
+	for _, plan := range plans.Plans {
+		if plan.Name == name {
+			return plan, nil
+		}
+	}
+	names := make([]string, 0, len(plans.Plans))
+	for _, plan := range plans.Plans {
+		names = append(names, plan.Name)
+	}
+	return Plan{}, fmt.Errorf("%w %q (available: %s)", ErrUnknownPlan, name, strings.Join(names, ", "))
+}
+
+// LookupStorePlan returns the named plan if stores of the given type can use
+// it, which takes the type to declare plan_values
+func LookupStorePlan(storeType, name string) (Plan, error) {
+	t, err := LookupStoreType(storeType)
+	if err != nil {
+		return Plan{}, err
+	}
+	if len(t.PlanValues) == 0 {
+		return Plan{}, fmt.Errorf("%w: store type %s does not support plans", ErrUnknownPlan, storeType)
+	}
+	return LookupPlan(name)
+}
+
+// ValidatePlanChange checks that a store can move between two plans. Volumes
+// can grow but never shrink.
+func ValidatePlanChange(from, to string) error {
+	if from == "" {
+		// The store ran with the chart's sizes; the volumes are checked at upgrade time
+		return nil
+	}
+	current, err := LookupPlan(from)
+	if err != nil {
+		// The store's plan was removed from the configuration; the volumes are checked at upgrade time
+		return nil
+	}
+	next, err := LookupPlan(to)
+	if err != nil {
+		return err
+	}
+	for _, volume := range []struct{ name, current, next string }{
+		{"app", current.AppStorage, next.AppStorage},
+		{"database", current.DatabaseStorage, next.DatabaseStorage},
+	} {
+		if size := resource.MustParse(volume.next); size.Cmp(resource.MustParse(volume.current)) < 0 {
+			return fmt.Errorf("plan %s has a smaller %s volume (%s) than plan %s (%s), and volumes cannot shrink", next.Name, volume.name, volume.next, current.Name, volume.current)
+		}
+	}
+	return nil
+}
+
+// applyPlan sets the resources, volume sizes and quota of the store's plan in
+// the chart values its store type maps them to. Stores without a plan keep the
+// chart's own sizes.
+func applyPlan(store models.Store, vals map[string]interface{}) error {
+	if store.Plan == "" {
+		return nil
+	}
+	plan, err := LookupStorePlan(store.Type, store.Plan)
+	if err != nil {
+		return err
+	}
+	t, _ := LookupStoreType(store.Type)
+	fields := plan.fields()
+	for field, path := range t.PlanValues {
+		setValue(vals, path, fields[field])
+	}
+	return nil
+}
+
+// resizeVolumes grows the store's PersistentVolumeClaims to the sizes of its
+// plan before an upgrade. The database claims belong to a StatefulSet, whose
+// claim template is immutable, so they are patched directly and the chart
+// keeps rendering the template with the size the StatefulSet was created with.
+func (p *HelmProvisioner) resizeVolumes(ctx context.Context, store models.Store, vals map[string]interface{}, logf LogFunc) error {
+	if store.Plan == "" {
+		return nil
+	}
+	plan, err := LookupStorePlan(store.Type, store.Plan)
+	if err != nil {
+		return err
+	}
+	t, _ := LookupStoreType(store.Type)
+	client, err := p.kubeClient()
+	if err != nil {
+		return err
+	}
+
+	database, hasDatabase := t.component("database")
+	if path, ok := t.PlanValues[planFieldDatabaseStorage]; ok && hasDatabase && database.Kind == "StatefulSet" {
+		statefulSets, err := client.AppsV1().StatefulSets(store.Namespace).List(ctx, metav1.ListOptions{LabelSelector: database.Selector})
+		if err != nil {
+			return fmt.Errorf("failed to list statefulsets: %w", err)
+		}
+		for _, s := range statefulSets.Items {
+			for _, template := range s.Spec.VolumeClaimTemplates {
+				if size, ok := template.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+					setValue(vals, path, size.String())
+				}
+			}
+		}
+	}
+
+	claims, err := client.CoreV1().PersistentVolumeClaims(store.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list persistent volume claims: %w", err)
+	}
+	databaseClaims := labels.Nothing()
+	if t.PodSelectors.Database != "" {
+		if databaseClaims, err = labels.Parse(t.PodSelectors.Database); err != nil {
+			return fmt.Errorf("invalid database pod selector of store type %s: %w", t.Name, err)
+		}
+	}
+	for _, claim := range claims.Items {
+		// Only volumes whose size the store type takes from the plan follow it
+		field := planFieldAppStorage
+		if databaseClaims.Matches(labels.Set(claim.Labels)) {
+			field = planFieldDatabaseStorage
+		}
+		if _, ok := t.PlanValues[field]; !ok {
+			continue
+		}
+		want := resource.MustParse(plan.fields()[field])
+		current := claim.Spec.Resources.Requests[corev1.ResourceStorage]
+		switch want.Cmp(current) {
+		case -1:
+			return fmt.Errorf("volume %s is %s and cannot shrink to %s of plan %s", claim.Name, current.String(), want.String(), plan.Name)
+		case 1:
+			patch := []byte(fmt.Sprintf(`{"spec":{"resources":{"requests":{"storage":%q}}}}`, want.String()))
+			if _, err := client.CoreV1().PersistentVolumeClaims(store.Namespace).Patch(ctx, claim.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+				return fmt.Errorf("failed to resize volume %s (does its StorageClass allow volume expansion?): %w", claim.Name, err)
+			}
+			logf.printf("Resizing PersistentVolumeClaim/%s from %s to %s", claim.Name, current.String(), want.String())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package orchestrator
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"urumi-backend/models"
+)
+
+// withStoreTypes replaces the store-type catalog for the duration of the test
+func withStoreTypes(t *testing.T, types ...StoreType) {
+	t.Helper()
+	saved := storeTypes
+	storeTypes = StoreTypeCatalog{Types: types}
+	t.Cleanup(func() { storeTypes = saved })
+}
+
+func TestApplyPlanUsesTheStoreTypesMapping(t *testing.T) {
+	withStoreTypes(t,
+		StoreType{Name: "woocommerce", PlanValues: map[string]string{
+			"app.limits.cpu":   "resources.limits.cpu",
+			"database_storage": "mariadb.primary.persistence.size",
+			"quota.pods":       "resourceQuota.pods",
+		}},
+		StoreType{Name: "medusa", PlanValues: map[string]string{
+			"app.limits.cpu": "resources.limits.cpu",
+		}},
+		StoreType{Name: "static"},
+	)
+	medium, err := LookupPlan("medium")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vals := map[string]interface{}{}
+	if err := applyPlan(models.Store{Type: "woocommerce", Plan: "medium"}, vals); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"resources":     map[string]interface{}{"limits": map[string]interface{}{"cpu": medium.App.Limits.CPU}},
+		"mariadb":       map[string]interface{}{"primary": map[string]interface{}{"persistence": map[string]interface{}{"size": medium.DatabaseStorage}}},
+		"resourceQuota": map[string]interface{}{"pods": medium.Quota.Pods},
+	}
+	if !reflect.DeepEqual(vals, want) {
+		t.Fatalf("woocommerce values = %v, want %v", vals, want)
+	}
+
+	vals = map[string]interface{}{}
+	if err := applyPlan(models.Store{Type: "medusa", Plan: "medium"}, vals); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := vals["mariadb"]; ok || len(vals) != 1 {
+		t.Fatalf("medusa values = %v, want only the app resources", vals)
+	}
+
+	// Stores without a plan keep the chart's sizes, whatever their type
+	for _, storeType := range []string{"woocommerce", "medusa", "static"} {
+		vals = map[string]interface{}{}
+		if err := applyPlan(models.Store{Type: storeType}, vals); err != nil || len(vals) != 0 {
+			t.Fatalf("applyPlan without a plan for %s = %v, %v; want no values", storeType, vals, err)
+		}
+	}
+
+	if err := applyPlan(models.Store{Type: "static", Plan: "small"}, map[string]interface{}{}); !errors.Is(err, ErrUnknownPlan) {
+		t.Fatalf("applyPlan for a type without plan_values = %v, want %v", err, ErrUnknownPlan)
+	}
+}
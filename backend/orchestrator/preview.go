@@ -0,0 +1,137 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"urumi-backend/models"
+	"urumi-backend/redact"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// Preview is what installing or upgrading a store would apply, rendered
+// without touching the cluster
+type Preview struct {
+	// Values are the computed chart values: the values file, the store's spec and the orchestrator's overrides.
+	Values map[string]interface{} `json:"values"`
+	// Manifest is the rendered chart, with the data of Secrets redacted.
+	Manifest string `json:"manifest"`
+	// DeployedRevision is the release revision the diff is against, 0 if the store has no release.
+	DeployedRevision int `json:"deployed_revision,omitempty"`
+	// Diff is a unified diff from the deployed manifest to the rendered one.
+	Diff string `json:"diff,omitempty"`
+}
+
+// secretKind matches the kind of a Secret manifest
+var secretKind = regexp.MustCompile(`(?m)^kind:\s*Secret\s*$`)
+
+// redactManifest masks the data of every Secret in a multi-document manifest,
+// and any registered secret that shows up elsewhere
+func redactManifest(manifest string) string {
+	docs := strings.Split(manifest, "\n---")
+	for i, doc := range docs {
+		if secretKind.MatchString(doc) {
+			docs[i] = maskSecretData(doc)
+		}
+	}
+	return redact.String(strings.Join(docs, "\n---"))
+}
+
+// maskSecretData replaces the values under a Secret's data and stringData with
+// the redaction mask, dropping the continuation lines of multi-line values
+func maskSecretData(doc string) string {
+	lines := strings.Split(doc, "\n")
+	masked := make([]string, 0, len(lines))
+	inData, keyIndent := false, -1
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+		if indent == 0 && trimmed != "" {
+			inData = trimmed == "data:" || trimmed == "stringData:"
+			keyIndent = -1
+			masked = append(masked, line)
+			continue
+		}
+		if !inData || trimmed == "" {
+			masked = append(masked, line)
+			continue
+		}
+		if keyIndent < 0 {
+			keyIndent = indent
+		}
+		if indent > keyIndent {
+			continue
+		}
+		if key, _, ok := strings.Cut(trimmed, ":"); ok {
+			line = line[:indent] + key + ": " + redact.Mask
+		}
+		masked = append(masked, line)
+	}
+	return strings.Join(masked, "\n")
+}
+
+// diffManifests returns a unified diff between two manifests
+func diffManifests(from, to, fromName, toName string) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from),
+		B:        difflib.SplitLines(to),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+}
+
+// releaseManifest returns the manifest of a release including its hooks
+func releaseManifest(rel *release.Release) string {
+	var b strings.Builder
+	b.WriteString(rel.Manifest)
+	for _, hook := range rel.Hooks {
+		fmt.Fprintf(&b, "\n---\n# Source: %s\n%s\n", hook.Path, hook.Manifest)
+	}
+	return b.String()
+}
+
+// Render renders the store's chart with the values an install or upgrade
+// would use, and diffs it against the release deployed in the cluster
+func (p *HelmProvisioner) Render(ctx context.Context, store models.Store) (*Preview, error) {
+	chrt, vals, err := p.loadChart(store)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := p.actionConfig(store, nil)
+	if err != nil {
+		return nil, err
+	}
+	deployed, err := action.NewGet(cfg).Run(store.Namespace)
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, fmt.Errorf("failed to get deployed release: %w", err)
+	}
+
+	// A client-only install renders the templates without contacting the cluster
+	install := action.NewInstall(&action.Configuration{Log: func(string, ...interface{}) {}})
+	install.DryRun = true
+	install.ClientOnly = true
+	install.ReleaseName = store.Namespace
+	install.Namespace = store.Namespace
+	install.IsUpgrade = deployed != nil
+	rendered, err := install.RunWithContext(ctx, chrt, vals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render chart: %w", err)
+	}
+
+	preview := &Preview{Values: vals, Manifest: redactManifest(releaseManifest(rendered))}
+	if deployed != nil {
+		preview.DeployedRevision = deployed.Version
+		from := fmt.Sprintf("revision %d (%s)", deployed.Version, deployed.Info.Status)
+		if preview.Diff, err = diffManifests(redactManifest(releaseManifest(deployed)), preview.Manifest, from, "preview"); err != nil {
+			return nil, fmt.Errorf("failed to diff manifests: %w", err)
+		}
+	}
+	return preview, nil
+}
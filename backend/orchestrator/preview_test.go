@@ -0,0 +1,89 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+	"urumi-backend/redact"
+)
+
+func TestMaskSecretData(t *testing.T) {
+	doc := `apiVersion: v1
+kind: Secret
+metadata:
+  name: store-credentials
+  labels:
+    password-policy: strict
+type: Opaque
+data:
+  admin-password: c2VjcmV0MQ==
+  mariadb-password: c2VjcmV0Mg==
+stringData:
+  config.php: |
+    define('DB_PASSWORD', 'plainsecret');
+    define('DB_HOST', 'db');
+  token: plaintoken`
+
+	want := `apiVersion: v1
+kind: Secret
+metadata:
+  name: store-credentials
+  labels:
+    password-policy: strict
+type: Opaque
+data:
+  admin-password: ` + redact.Mask + `
+  mariadb-password: ` + redact.Mask + `
+stringData:
+  config.php: ` + redact.Mask + `
+  token: ` + redact.Mask
+
+	if got := maskSecretData(doc); got != want {
+		t.Fatalf("maskSecretData =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRedactManifest(t *testing.T) {
+	const registered = "Reg1steredPassw0rd"
+	redact.Register(registered)
+	manifest := `---
+# Source: woocommerce/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: store-credentials
+data:
+  admin-password: c2VjcmV0MQ==
+---
+# Source: woocommerce/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  site-title: Summer Shop
+  note: "uses ` + registered + `"
+---
+# Source: woocommerce/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: store
+spec:
+  replicas: 1`
+
+	got := redactManifest(manifest)
+	for _, leaked := range []string{"c2VjcmV0MQ==", registered} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("redacted manifest still contains %s:\n%s", leaked, got)
+		}
+	}
+	// Only Secrets have their data masked, and every document survives
+	for _, kept := range []string{"site-title: Summer Shop", "kind: ConfigMap", "kind: Deployment", "replicas: 1", "admin-password: " + redact.Mask} {
+		if !strings.Contains(got, kept) {
+			t.Errorf("redacted manifest lost %q:\n%s", kept, got)
+		}
+	}
+	if strings.Count(got, "\n---") != strings.Count(manifest, "\n---") {
+		t.Errorf("redacted manifest has a different number of documents:\n%s", got)
+	}
+}
@@ -0,0 +1,138 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"urumi-backend/models"
+)
+
+// Provisioner manages the cluster side of a store's lifecycle.
+// Handlers and the reconciler depend on this interface rather than on a
+// concrete backend so the cluster driver can be swapped out.
+type Provisioner interface {
+	// Install deploys the store's release, upgrading it in place if it
+	// already exists (the equivalent of `helm upgrade --install`).
+	// Progress is written to logf as it happens.
+	Install(ctx context.Context, store models.Store, logf LogFunc) error
+	// Upgrade re-applies the store's chart to an existing release.
+	Upgrade(ctx context.Context, store models.Store, logf LogFunc) error
+	// Revisions lists the store's Helm release history, newest first.
+	Revisions(ctx context.Context, store models.Store) ([]Revision, error)
+	// Rollback rolls the store's release back to an earlier revision.
+	Rollback(ctx context.Context, store models.Store, revision int, logf LogFunc) error
+	// Render previews what Install or Upgrade would apply, without applying it.
+	Render(ctx context.Context, store models.Store) (*Preview, error)
+	// Uninstall removes the store's release and its namespace.
+	Uninstall(ctx context.Context, store models.Store) error
+	// Status reports the observed state of the store in the cluster.
+	Status(ctx context.Context, store models.Store) (*StoreStatus, error)
+	// CheckHealth probes the store's public endpoint.
+	CheckHealth(ctx context.Context, store models.Store) (bool, error)
+	// Resources lists what exists in the cluster for the store, as "Kind/name".
+	Resources(ctx context.Context, store models.Store) ([]string, error)
+	// Credentials reads the store's generated credentials from its Secret.
+	Credentials(ctx context.Context, store models.Store) (*Credentials, error)
+	// RotateCredentials replaces the store's passwords, applies them to the
+	// running store and restarts the pods that read them. Data is kept.
+	RotateCredentials(ctx context.Context, store models.Store, logf LogFunc) error
+}
+
+// LogFunc receives the output of an install or upgrade line by line; a nil LogFunc discards it
+type LogFunc func(format string, v ...interface{})
+
+func (f LogFunc) printf(format string, v ...interface{}) {
+	if f != nil {
+		f(format, v...)
+	}
+}
+
+// Watcher is implemented by provisioners that can push cluster changes.
+// Watch starts watching in the background and calls notify with the ID of
+// every store whose resources changed, until ctx is cancelled.
+type Watcher interface {
+	Watch(ctx context.Context, notify func(storeID string)) error
+}
+
+// StoreIDLabel marks every namespace and workload that belongs to a store
+const StoreIDLabel = "urumi.io/store-id"
+
+// StoreStatus is the observed state of a store in the cluster
+type StoreStatus struct {
+	// NamespaceExists is false when the store's namespace is gone.
+	NamespaceExists bool
+	// Release is the Helm release status (e.g. "deployed", "failed").
+	Release string
+	// Phase is aggregated from the required components: Running, Pending, Failed or Unknown.
+	Phase string
+	// Components is the readiness of every workload in the store namespace.
+	Components []ComponentStatus
+	// Ingresses is the state of the ingresses in the store namespace.
+	Ingresses []IngressStatus
+}
+
+var (
+	// ErrReleaseNotFound is returned when the store has no Helm release.
+	ErrReleaseNotFound = errors.New("release not found")
+	// ErrChartNotFound is returned when the chart for a store type cannot be located.
+	ErrChartNotFound = errors.New("chart not found")
+)
+
+// NewProvisionerFromEnv picks the cluster driver named by $ORCHESTRATOR_DRIVER:
+// "helm" (the default) talks to a real cluster, "simulated" keeps everything in memory.
+func NewProvisionerFromEnv() (Provisioner, error) {
+	switch driver := os.Getenv("ORCHESTRATOR_DRIVER"); driver {
+	case "", "helm":
+		return NewHelmProvisioner(), nil
+	case "simulated":
+		config, err := SimulationConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return NewSimulatedProvisioner(config), nil
+	default:
+		return nil, fmt.Errorf("unknown ORCHESTRATOR_DRIVER %q (expected \"helm\" or \"simulated\")", driver)
+	}
+}
+
+// kubeconfigPath resolves the kubeconfig from $KUBECONFIG or ~/.kube/config
+func kubeconfigPath() string {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	if kubeconfig == "" {
+		home, _ := os.UserHomeDir()
+		kubeconfig = filepath.Join(home, ".kube", "config")
+	}
+	return kubeconfig
+}
+
+// chartsDir locates the charts directory relative to the working directory,
+// falling back to $CHARTS_DIR
+func chartsDir() (string, error) {
+	baseDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current working directory: %w", err)
+	}
+
+	// Check if running from root or backend
+	if _, err := os.Stat(filepath.Join(baseDir, "charts")); err == nil {
+		return filepath.Join(baseDir, "charts"), nil
+	}
+	if _, err := os.Stat(filepath.Join(baseDir, "../charts")); err == nil {
+		return filepath.Join(baseDir, "../charts"), nil
+	}
+	if dir := os.Getenv("CHARTS_DIR"); dir != "" {
+		return dir, nil
+	}
+	return "", fmt.Errorf("could not locate charts directory: %w", ErrChartNotFound)
+}
+
+// domainSuffix returns the ingress domain suffix for store hosts
+func domainSuffix() string {
+	suffix := os.Getenv("DOMAIN_SUFFIX")
+	if suffix == "" {
+		suffix = "localhost" // Default for local dev
+	}
+	return suffix
+}
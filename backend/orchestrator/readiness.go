@@ -0,0 +1,211 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Component is a workload a store type needs before it can serve traffic
+type Component struct {
+	Name     string `json:"name"`     // Logical name, e.g. "app" or "database"
+	Kind     string `json:"kind"`     // "Deployment" or "StatefulSet"
+	Selector string `json:"selector"` // Label selector matching the workload in the store namespace
+}
+
+// ComponentStatus is the observed readiness of one workload in a store namespace
+type ComponentStatus struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Required bool   `json:"required"`
+	Ready    bool   `json:"ready"`
+	Restarts int32  `json:"restarts"`
+	Reason   string `json:"reason,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// crashLoopRestarts is the restart count after which a not-ready component is considered failed
+const crashLoopRestarts = 5
+
+// failedWaitingReasons are container waiting reasons that will not resolve on their own
+var failedWaitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"CreateContainerConfigError": true,
+	"InvalidImageName":           true,
+}
+
+// workload is a Deployment or StatefulSet reduced to what readiness needs
+type workload struct {
+	name     string
+	kind     string
+	labels   labels.Set
+	selector labels.Selector
+	ready    bool
+	message  string
+}
+
+// componentReadiness computes the readiness of every workload in the namespace,
+// marking the ones the store type declares as required
+func componentReadiness(ctx context.Context, client kubernetes.Interface, namespace, storeType string) ([]ComponentStatus, error) {
+	deployments, err := client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	statefulSets, err := client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	var workloads []workload
+	for _, d := range deployments.Items {
+		workloads = append(workloads, deploymentWorkload(d))
+	}
+	for _, s := range statefulSets.Items {
+		workloads = append(workloads, statefulSetWorkload(s))
+	}
+
+	var statuses []ComponentStatus
+	matched := make(map[string]bool)
+
+	for _, component := range componentsOf(storeType) {
+		selector, err := labels.Parse(component.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector for component %s: %w", component.Name, err)
+		}
+		status := ComponentStatus{Name: component.Name, Kind: component.Kind, Required: true, Reason: "NotFound",
+			Message: fmt.Sprintf("no %s matches %s", component.Kind, component.Selector)}
+		for _, w := range workloads {
+			if w.kind == component.Kind && selector.Matches(w.labels) {
+				status = workloadStatus(w, pods.Items)
+				status.Name = component.Name
+				status.Required = true
+				matched[w.kind+"/"+w.name] = true
+				break
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	// Report any other workload too, so nothing in the namespace is invisible
+	for _, w := range workloads {
+		if !matched[w.kind+"/"+w.name] {
+			statuses = append(statuses, workloadStatus(w, pods.Items))
+		}
+	}
+	return statuses, nil
+}
+
+func deploymentWorkload(d appsv1.Deployment) workload {
+	desired := int32(1)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+	selector, _ := metav1.LabelSelectorAsSelector(d.Spec.Selector)
+	w := workload{name: d.Name, kind: "Deployment", labels: d.Labels, selector: selector}
+	w.ready = d.Status.ObservedGeneration >= d.Generation &&
+		d.Status.UpdatedReplicas >= desired &&
+		d.Status.AvailableReplicas >= desired
+	w.message = fmt.Sprintf("%d/%d replicas available", d.Status.AvailableReplicas, desired)
+	return w
+}
+
+func statefulSetWorkload(s appsv1.StatefulSet) workload {
+	desired := int32(1)
+	if s.Spec.Replicas != nil {
+		desired = *s.Spec.Replicas
+	}
+	selector, _ := metav1.LabelSelectorAsSelector(s.Spec.Selector)
+	w := workload{name: s.Name, kind: "StatefulSet", labels: s.Labels, selector: selector}
+	w.ready = s.Status.ObservedGeneration >= s.Generation &&
+		s.Status.ReadyReplicas >= desired
+	w.message = fmt.Sprintf("%d/%d replicas ready", s.Status.ReadyReplicas, desired)
+	return w
+}
+
+// workloadStatus combines the workload's replica counts with its pods' container states
+func workloadStatus(w workload, pods []corev1.Pod) ComponentStatus {
+	status := ComponentStatus{Name: w.name, Kind: w.kind, Ready: w.ready, Message: w.message}
+	if !w.ready {
+		status.Reason = "NotReady"
+	}
+	if w.selector == nil {
+		return status
+	}
+
+	for _, pod := range pods {
+		if !w.selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		containers := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, cs := range containers {
+			status.Restarts += cs.RestartCount
+			if w.ready || cs.State.Waiting == nil || cs.State.Waiting.Reason == "" {
+				continue
+			}
+			if failedWaitingReasons[cs.State.Waiting.Reason] || status.Reason == "NotReady" {
+				status.Reason = cs.State.Waiting.Reason
+				status.Message = strings.TrimSpace(fmt.Sprintf("container %s: %s", cs.Name, cs.State.Waiting.Message))
+			}
+		}
+	}
+	return status
+}
+
+// aggregatePhase turns component readiness into a single store phase:
+// Running when every required component is ready, Failed when one of them
+// cannot recover on its own, Pending otherwise and Unknown if nothing is deployed
+func aggregatePhase(components []ComponentStatus) string {
+	if len(components) == 0 {
+		return "Unknown"
+	}
+
+	phase := "Running"
+	found := false
+	for _, c := range components {
+		if !c.Required {
+			continue
+		}
+		if c.Reason != "NotFound" {
+			found = true
+		}
+		if c.Ready {
+			continue
+		}
+		if failedWaitingReasons[c.Reason] || c.Restarts >= crashLoopRestarts {
+			return "Failed"
+		}
+		phase = "Pending"
+	}
+	if !found {
+		return "Unknown"
+	}
+	return phase
+}
+
+// notReadySummary describes the required components that are not ready
+func notReadySummary(components []ComponentStatus) string {
+	var parts []string
+	for _, c := range components {
+		if !c.Required || c.Ready {
+			continue
+		}
+		part := fmt.Sprintf("%s not ready (%s", c.Name, c.Reason)
+		if c.Restarts > 0 {
+			part += fmt.Sprintf(", %d restarts", c.Restarts)
+		}
+		parts = append(parts, part+")")
+	}
+	return strings.Join(parts, "; ")
+}
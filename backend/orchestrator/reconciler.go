@@ -0,0 +1,198 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"urumi-backend/models"
+
+	"gorm.io/gorm"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// ReconcileStoreStatus compares the store's recorded status and conditions with
+// the cluster and writes what it observes (and the reason for it) back to the database
+func ReconcileStoreStatus(ctx context.Context, db *gorm.DB, prov Provisioner, store models.Store) error {
+	// Stores being torn down are owned by the deletion; cancelled stores have nothing deployed
+	switch store.Status {
+	case models.StatusDeleting, models.StatusDeletionFailed, models.StatusCancelled:
+		return nil
+	}
+
+	observed, err := prov.Status(ctx, store)
+	if err != nil {
+		log.Printf("Failed to get cluster status for store %s: %v", store.ID, err)
+		return err
+	}
+
+	previousHealth := store.Conditions.Get(models.ConditionHealthCheckPassing)
+	if previousHealth != nil {
+		copied := *previousHealth
+		previousHealth = &copied
+	}
+
+	updates := map[string]interface{}{}
+	if updateConditions(ctx, prov, &store, observed) {
+		updates["conditions"] = store.Conditions
+	}
+
+	// Provisioning stores keep their status until the provisioning finishes.
+	// Writes only succeed if nobody else moved the store since it was read.
+	if status, reason := expectedStatus(store, observed); store.Status != models.StatusProvisioning && status != store.Status {
+		err = models.TransitionStatus(db, &store, status, reason, models.ActorReconciler, updates)
+	} else if len(updates) > 0 {
+		err = models.UpdateStore(db, &store, updates)
+	}
+	if err != nil {
+		return err
+	}
+
+	if health := store.Conditions.Get(models.ConditionHealthCheckPassing); healthCheckFailed(previousHealth, health) {
+		models.RecordEvent(db, store.ID, models.EventHealthCheckFailed, models.ActorReconciler, health.Reason, health.Message)
+	}
+	return nil
+}
+
+// healthCheckFailed reports whether the health check just started failing.
+// Waiting for the app to come up is not a failure.
+func healthCheckFailed(previous, current *models.Condition) bool {
+	if current == nil || current.Status != models.ConditionFalse || current.Reason == "AppNotReady" {
+		return false
+	}
+	return previous == nil || previous.Status != current.Status || previous.Reason != current.Reason
+}
+
+// expectedStatus maps the observed cluster state to a store status and a human readable reason
+func expectedStatus(store models.Store, observed *StoreStatus) (string, string) {
+	switch {
+	case !observed.NamespaceExists:
+		if store.Status == models.StatusFailed {
+			// A failed install may never have created the namespace
+			return store.Status, store.StatusReason
+		}
+		return models.StatusLost, fmt.Sprintf("namespace %s no longer exists", store.Namespace)
+	case observed.Release == "":
+		return models.StatusLost, fmt.Sprintf("helm release %s is missing", store.Namespace)
+	case observed.Release == "failed":
+		return models.StatusFailed, fmt.Sprintf("helm release %s is in failed state", store.Namespace)
+	case observed.Phase == "Running":
+		return models.StatusReady, "all required components are ready"
+	case observed.Phase == "Failed":
+		return models.StatusFailed, notReadySummary(observed.Components)
+	case store.Status == models.StatusFailed:
+		// Nothing new to report until the pods recover
+		return store.Status, store.StatusReason
+	case observed.Phase == "Unknown":
+		return models.StatusDegraded, "no store workloads found"
+	default:
+		return models.StatusDegraded, notReadySummary(observed.Components)
+	}
+}
+
+// reconcileWorkers is the number of stores reconciled in parallel
+const reconcileWorkers = 4
+
+// Reconciler keeps models.Store in sync with the cluster. Stores are queued by
+// cluster watch events (when the provisioner supports them) and by a periodic
+// full resync that acts as a safety net for missed events.
+type Reconciler struct {
+	db     *gorm.DB
+	prov   Provisioner
+	resync time.Duration
+	queue  workqueue.TypedRateLimitingInterface[string]
+}
+
+// NewReconciler creates a reconciler that resyncs every store at the given interval
+func NewReconciler(db *gorm.DB, prov Provisioner, resync time.Duration) *Reconciler {
+	return &Reconciler{
+		db:     db,
+		prov:   prov,
+		resync: resync,
+		queue:  workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+	}
+}
+
+// Enqueue schedules a store for reconciliation
+func (r *Reconciler) Enqueue(storeID string) {
+	r.queue.Add(storeID)
+}
+
+// Run starts the watch, the workers and the periodic resync, and blocks until ctx is done
+func (r *Reconciler) Run(ctx context.Context) {
+	defer r.queue.ShutDown()
+
+	log.Printf("Starting store reconciler (resync every %s)", r.resync)
+
+	if watcher, ok := r.prov.(Watcher); ok {
+		go func() {
+			if err := watcher.Watch(ctx, r.Enqueue); err != nil {
+				log.Printf("Failed to start cluster watch, relying on periodic resync: %v", err)
+			}
+		}()
+	}
+
+	for i := 0; i < reconcileWorkers; i++ {
+		go func() {
+			for r.processNext(ctx) {
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(r.resync)
+	defer ticker.Stop()
+
+	r.enqueueAll()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.enqueueAll()
+		}
+	}
+}
+
+// enqueueAll queues every store for a full resync
+func (r *Reconciler) enqueueAll() {
+	var ids []string
+	if err := r.db.Model(&models.Store{}).Pluck("id", &ids).Error; err != nil {
+		log.Printf("Failed to fetch stores for reconciliation: %v", err)
+		return
+	}
+	for _, id := range ids {
+		r.queue.Add(id)
+	}
+}
+
+func (r *Reconciler) processNext(ctx context.Context) bool {
+	id, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(id)
+
+	var store models.Store
+	err := r.db.First(&store, "id = ?", id).Error
+	if err == nil {
+		err = ReconcileStoreStatus(ctx, r.db, r.prov, store)
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Store was deleted; nothing to reconcile
+		err = nil
+	}
+
+	switch {
+	case err == nil:
+		r.queue.Forget(id)
+	case errors.Is(err, models.ErrInvalidTransition):
+		// Already logged by the state machine; retrying won't make it legal
+		r.queue.Forget(id)
+	case r.queue.NumRequeues(id) < 5:
+		r.queue.AddRateLimited(id)
+	default:
+		log.Printf("Giving up reconciling store %s until next resync: %v", id, err)
+		r.queue.Forget(id)
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"urumi-backend/models"
+)
+
+// recoveryTimeout bounds how long startup recovery may spend inspecting the cluster
+const recoveryTimeout = 2 * time.Minute
+
+// recoverStores looks at every store left in Provisioning or Deleting by a
+// previous process and compares it with the real release and namespace state.
+// Depending on what it finds the store's work is resumed (by leaving or enqueuing
+// a job), finished right away, or the store is marked failed with an explanation.
+func (q *JobQueue) recoverStores(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, recoveryTimeout)
+	defer cancel()
+
+	var stores []models.Store
+	if err := q.db.Where("status IN ?", []string{models.StatusProvisioning, models.StatusDeleting}).Find(&stores).Error; err != nil {
+		log.Printf("Failed to fetch in-flight stores for recovery: %v", err)
+		return
+	}
+	if len(stores) > 0 {
+		log.Printf("Recovering %d in-flight stores", len(stores))
+	}
+
+	for _, store := range stores {
+		if err := q.recoverStore(ctx, store); err != nil {
+			log.Printf("Failed to recover store %s: %v", store.ID, err)
+		}
+	}
+}
+
+func (q *JobQueue) recoverStore(ctx context.Context, store models.Store) error {
+	job, err := models.ActiveJob(q.db, store.ID)
+	if err != nil {
+		return err
+	}
+
+	jobType := models.JobInstall
+	if store.Status == models.StatusDeleting {
+		jobType = models.JobUninstall
+	}
+
+	observed, err := q.prov.Status(ctx, store)
+	if err != nil {
+		// Both jobs are idempotent, so resuming is safe even without knowing the cluster state
+		log.Printf("Failed to get cluster status for store %s, resuming its %s: %v", store.ID, jobType, err)
+		return q.resume(store, job, jobType, "cluster state unknown")
+	}
+
+	if store.Status == models.StatusDeleting {
+		if job == nil && !observed.NamespaceExists {
+			// The uninstall finished but the process died before removing the record
+			result := q.db.Where("status = ?", models.StatusDeleting).Delete(&store)
+			if result.Error != nil {
+				return fmt.Errorf("failed to delete store record: %w", result.Error)
+			}
+			if result.RowsAffected == 0 {
+				return nil
+			}
+			models.RecordStoreChange(q.db, models.ChangeDeleted, &store)
+			models.RecordEvent(q.db, store.ID, models.EventRecovered, models.ActorRecovery, "deletion finished before restart", "namespace already gone")
+			models.RecordEvent(q.db, store.ID, models.EventStoreDeleted, models.ActorRecovery, "release and namespace removed", "")
+			return nil
+		}
+		return q.resume(store, job, jobType, fmt.Sprintf("namespace exists: %t, release: %q", observed.NamespaceExists, observed.Release))
+	}
+
+	switch {
+	case strings.HasPrefix(observed.Release, "pending-") && observed.Release != "pending-install":
+		// Helm keeps the release locked after an interrupted operation. The install
+		// job clears a stale pending-install itself, anything else needs an operator.
+		reason := fmt.Sprintf("helm release was left %s by an interrupted operation, delete the store or repair the release", observed.Release)
+		if job != nil {
+			if err := models.FinishJob(q.db, job, fmt.Errorf("%s", reason)); err != nil {
+				return err
+			}
+			if err := models.FinishOperation(q.db, job.OperationID, models.JobFailed, "", FailureUnknown, reason); err != nil {
+				return err
+			}
+		}
+		models.RecordEvent(q.db, store.ID, models.EventRecovered, models.ActorRecovery, "install interrupted", reason)
+		failure := Failure{Code: FailureUnknown, Hint: "Delete the store, or roll the release back with helm and retry."}
+		_, err := models.Transition(q.db, store.ID, models.StatusFailed, reason, models.ActorRecovery, failureColumns(&ProvisionError{Failure: failure, Err: errors.New(reason)}))
+		return err
+	case job != nil:
+		return q.resume(store, job, jobType, fmt.Sprintf("release: %q", observed.Release))
+	case observed.Release == "failed":
+		reason := "helm install failed before restart"
+		models.RecordEvent(q.db, store.ID, models.EventRecovered, models.ActorRecovery, "install failed before restart", fmt.Sprintf("release %s is in failed state", store.Namespace))
+		_, err := models.Transition(q.db, store.ID, models.StatusFailed, reason, models.ActorRecovery, failureColumns(errors.New(reason)))
+		return err
+	case observed.Release == "deployed" && observed.Phase == "Running":
+		models.RecordEvent(q.db, store.ID, models.EventRecovered, models.ActorRecovery, "install finished before restart", "release deployed and all required components ready")
+		_, err := models.Transition(q.db, store.ID, models.StatusReady, "helm install completed", models.ActorRecovery, nil)
+		return err
+	default:
+		return q.resume(store, nil, jobType, fmt.Sprintf("release: %q, phase: %s", observed.Release, observed.Phase))
+	}
+}
+
+// resume makes sure the store has a job to carry on with, enqueuing one if needed
+func (q *JobQueue) resume(store models.Store, job *models.Job, jobType, details string) error {
+	if job != nil {
+		log.Printf("Resuming %s job %d for store %s", job.Type, job.ID, store.ID)
+		models.RecordEvent(q.db, store.ID, models.EventRecovered, models.ActorRecovery, fmt.Sprintf("resuming %s job %d", job.Type, job.ID), details)
+		return nil
+	}
+
+	operationType := models.OperationCreate
+	if jobType == models.JobUninstall {
+		operationType = models.OperationDelete
+	}
+	operation, err := models.StartOperation(q.db, store.ID, operationType, jobType)
+	if err != nil {
+		return err
+	}
+	log.Printf("Enqueued %s job for operation %s to resume store %s", jobType, operation.ID, store.ID)
+	models.RecordEvent(q.db, store.ID, models.EventRecovered, models.ActorRecovery, fmt.Sprintf("resuming with new %s operation %s", jobType, operation.ID), details)
+	return nil
+}
@@ -0,0 +1,99 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy decides whether and when a failed install is retried automatically
+type RetryPolicy struct {
+	// MaxAttempts is the total number of install attempts per job; 1 disables automatic retries.
+	MaxAttempts int
+	// Backoff is the delay before the first retry; it doubles with every attempt.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff time.Duration
+}
+
+// RetryPolicyFromEnv reads PROVISION_MAX_ATTEMPTS, PROVISION_RETRY_BACKOFF and PROVISION_RETRY_MAX_BACKOFF
+func RetryPolicyFromEnv() (RetryPolicy, error) {
+	policy := RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     30 * time.Second,
+		MaxBackoff:  10 * time.Minute,
+	}
+
+	if v := os.Getenv("PROVISION_MAX_ATTEMPTS"); v != "" {
+		attempts, err := strconv.Atoi(v)
+		if err != nil || attempts < 1 {
+			return policy, fmt.Errorf("invalid PROVISION_MAX_ATTEMPTS %q: must be a positive integer", v)
+		}
+		policy.MaxAttempts = attempts
+	}
+	if v := os.Getenv("PROVISION_RETRY_BACKOFF"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return policy, fmt.Errorf("invalid PROVISION_RETRY_BACKOFF %q: %w", v, err)
+		}
+		policy.Backoff = d
+	}
+	if v := os.Getenv("PROVISION_RETRY_MAX_BACKOFF"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return policy, fmt.Errorf("invalid PROVISION_RETRY_MAX_BACKOFF %q: %w", v, err)
+		}
+		policy.MaxBackoff = d
+	}
+	return policy, nil
+}
+
+// Delay returns how long to wait before the attempt that follows the given one
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// ShouldRetry reports whether a failed attempt is worth retrying automatically
+func (p RetryPolicy) ShouldRetry(attempt int, err error) bool {
+	return attempt < p.MaxAttempts && isTransient(err)
+}
+
+// transientMessages are fragments of errors that usually go away on their own
+var transientMessages = []string{
+	"ImagePullBackOff",
+	"ErrImagePull",
+	"timed out waiting for the condition",
+	"context deadline exceeded",
+	"connection refused",
+	"connection reset by peer",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"the server is currently unable to handle the request",
+	"etcdserver: request timed out",
+}
+
+// isTransient reports whether an install error is likely to succeed on a later attempt.
+// Misconfiguration such as a missing chart or an exceeded quota is not retried.
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, ErrChartNotFound) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	msg := err.Error()
+	for _, fragment := range transientMessages {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+	"urumi-backend/models"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// storeSpecKey is the chart value under which a release records the store spec it was deployed with
+const storeSpecKey = "storeSpec"
+
+// ErrRevisionNotFound is returned when a rollback targets a revision the release does not have
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is one entry of a store's Helm release history
+type Revision struct {
+	Revision     int       `json:"revision"`
+	Status       string    `json:"status"` // Helm release status: deployed, superseded, failed...
+	ChartVersion string    `json:"chart_version"`
+	AppVersion   string    `json:"app_version,omitempty"`
+	ValuesDigest string    `json:"values_digest"` // sha256 of the values the revision was deployed with
+	Description  string    `json:"description,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	// The store spec the revision was deployed with, restored by a rollback to it
+	Plan     string             `json:"plan,omitempty"`
+	ImageTag string             `json:"image_tag,omitempty"`
+	Values   models.ChartValues `json:"values,omitempty"`
+}
+
+// valuesDigest hashes chart values. JSON objects are encoded with sorted keys,
+// so equal values always have the same digest.
+func valuesDigest(vals map[string]interface{}) string {
+	b, err := json.Marshal(vals)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// setSpecFromValues fills in the store spec recorded by applySpec
+func (r *Revision) setSpecFromValues(vals map[string]interface{}) {
+	spec, ok := vals[storeSpecKey].(map[string]interface{})
+	if !ok {
+		return
+	}
+	r.Plan, _ = spec["plan"].(string)
+	r.ImageTag, _ = spec["imageTag"].(string)
+	if values, _ := spec["values"].(map[string]interface{}); len(values) > 0 {
+		r.Values = models.ChartValues(values)
+	}
+}
+
+// findRevision returns the revision with the given number
+func findRevision(revisions []Revision, number int) (*Revision, error) {
+	for i := range revisions {
+		if revisions[i].Revision == number {
+			return &revisions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %d", ErrRevisionNotFound, number)
+}
+
+// Revisions lists the store's release history, newest first
+func (p *HelmProvisioner) Revisions(ctx context.Context, store models.Store) ([]Revision, error) {
+	cfg, err := p.actionConfig(store, nil)
+	if err != nil {
+		return nil, err
+	}
+	history := action.NewHistory(cfg)
+	history.Max = 256
+	releases, err := history.Run(store.Namespace)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, ErrReleaseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read release history: %w", err)
+	}
+
+	revisions := make([]Revision, 0, len(releases))
+	for _, rel := range releases {
+		revisions = append(revisions, revisionFromRelease(rel))
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision > revisions[j].Revision })
+	return revisions, nil
+}
+
+// revisionFromRelease describes one release revision
+func revisionFromRelease(rel *release.Release) Revision {
+	revision := Revision{Revision: rel.Version, ValuesDigest: valuesDigest(rel.Config)}
+	if rel.Info != nil {
+		revision.Status = rel.Info.Status.String()
+		revision.Description = rel.Info.Description
+		revision.UpdatedAt = rel.Info.LastDeployed.Time
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		revision.ChartVersion = rel.Chart.Metadata.Version
+		revision.AppVersion = rel.Chart.Metadata.AppVersion
+	}
+	revision.setSpecFromValues(rel.Config)
+	return revision
+}
+
+// Rollback runs the equivalent of `helm rollback` to the given revision and
+// waits for the rolled back resources to be ready
+func (p *HelmProvisioner) Rollback(ctx context.Context, store models.Store, revision int, logf LogFunc) error {
+	cfg, err := p.actionConfig(store, logf)
+	if err != nil {
+		return err
+	}
+
+	logf.printf("Rolling back release %s to revision %d", store.Namespace, revision)
+	stopEvents := p.streamEvents(ctx, store, logf)
+	defer stopEvents()
+	if err := p.rollbackTo(ctx, cfg, store, revision); err != nil {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return fmt.Errorf("helm rollback failed: %w", ErrReleaseNotFound)
+		}
+		log.Printf("Error rolling back store %s: %v", store.ID, err)
+		return fmt.Errorf("helm rollback failed: %w", err)
+	}
+
+	log.Printf("Successfully rolled back store %s to revision %d", store.ID, revision)
+	return nil
+}
+
+// rollbackTo rolls the release back to revision, 0 meaning the previous one,
+// and waits until its workloads are rolled out. Helm's rollback takes no
+// context, so it does not wait itself; the wait here stops when ctx is done,
+// like the one of an install or upgrade.
+func (p *HelmProvisioner) rollbackTo(ctx context.Context, cfg *action.Configuration, store models.Store, revision int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	client, err := p.kubeClient()
+	if err != nil {
+		return err
+	}
+	rollback := action.NewRollback(cfg)
+	rollback.Version = revision
+	rollback.Timeout = helmTimeout
+	if err := rollback.Run(store.Namespace); err != nil {
+		return err
+	}
+	err = wait.PollUntilContextTimeout(ctx, 2*time.Second, helmTimeout, true, func(ctx context.Context) (bool, error) {
+		return rolledOut(ctx, client, store.Namespace)
+	})
+	if err != nil {
+		return fmt.Errorf("failed waiting for the rolled back pods to become ready: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"urumi-backend/models"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestRollbackStopsWithContext(t *testing.T) {
+	p, _ := newFakeHelmProvisioner()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The rollback is not started at all once the job is cancelled
+	err := p.rollbackTo(ctx, nil, models.Store{ID: "s1", Namespace: "store-s1"}, 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("rollbackTo with a cancelled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestRollBackStuckUpgrade(t *testing.T) {
+	p, _ := newFakeHelmProvisioner()
+	store := models.Store{ID: "s1", Namespace: "store-s1"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	latest := func(status release.Status) []*release.Release {
+		return []*release.Release{{Name: store.Namespace, Info: &release.Info{Status: status}}}
+	}
+
+	// Releases that are not stuck are upgraded as they are
+	for _, releases := range [][]*release.Release{nil, latest(release.StatusDeployed), latest(release.StatusFailed)} {
+		if err := p.rollBackStuckUpgrade(ctx, nil, store, releases, nil); err != nil {
+			t.Fatalf("rollBackStuckUpgrade(%v) = %v, want no rollback", releases, err)
+		}
+	}
+	// Stuck ones are rolled back first, which the cancelled context stops
+	for _, status := range []release.Status{release.StatusPendingUpgrade, release.StatusPendingRollback} {
+		if err := p.rollBackStuckUpgrade(ctx, nil, store, latest(status), nil); !errors.Is(err, context.Canceled) {
+			t.Fatalf("rollBackStuckUpgrade for a %s release = %v, want a rollback stopped with %v", status, err, context.Canceled)
+		}
+	}
+}
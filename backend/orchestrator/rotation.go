@@ -0,0 +1,259 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"urumi-backend/models"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// pendingKeyPrefix marks the passwords of a rotation in progress. They are
+// saved in the Secret before they are applied, so a rotation interrupted
+// halfway is finished with the same passwords instead of locking the store out.
+const pendingKeyPrefix = "pending-"
+
+// RestartedAtAnnotation is set on pod templates to restart them, like `kubectl rollout restart`
+const RestartedAtAnnotation = "urumi.io/restarted-at"
+
+// RotateCredentials generates new passwords, sets them in the store's database
+// and app as its type's catalog entry says, saves them in the credentials Secret and restarts the store's
+// workloads so they pick them up. Volumes are untouched, so no data is lost.
+func (p *HelmProvisioner) RotateCredentials(ctx context.Context, store models.Store, logf LogFunc) error {
+	storeType, err := LookupStoreType(store.Type)
+	if err != nil {
+		return err
+	}
+	client, err := p.kubeClient()
+	if err != nil {
+		return err
+	}
+	secrets := client.CoreV1().Secrets(store.Namespace)
+	secret, err := secrets.Get(ctx, CredentialsSecretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return ErrCredentialsNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get credentials secret: %w", err)
+	}
+
+	current := credentialsFromSecret(secret)
+	next := credentialsFromData(secret.Data, pendingKeyPrefix)
+	if next.AdminPassword == "" {
+		if next, err = generateCredentials(); err != nil {
+			return err
+		}
+		next.AdminUsername = current.AdminUsername
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		for key, value := range next.data(pendingKeyPrefix) {
+			secret.Data[key] = value
+		}
+		if secret, err = secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to save new credentials: %w", err)
+		}
+		logf.printf("Generated new credentials")
+	} else {
+		logf.printf("Resuming an interrupted rotation with the credentials generated for it")
+	}
+
+	// Only some store types have a database and an admin account to update
+	if rotation := storeType.CredentialRotation; rotation != nil {
+		if rotation.DatabaseUsername != "" {
+			if err := p.rotateDatabasePasswords(ctx, client, store, storeType.PodSelectors.Database, rotation.DatabaseUsername, current, next, logf); err != nil {
+				return err
+			}
+		}
+		if rotation.AdminCommand != "" {
+			if err := p.rotateAdminPassword(ctx, client, store, storeType.PodSelectors.App, rotation, next, logf); err != nil {
+				return err
+			}
+		}
+	}
+
+	secret.Data = next.data("")
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update credentials secret: %w", err)
+	}
+	logf.printf("Updated secret %s/%s", store.Namespace, CredentialsSecretName)
+	current.unregister()
+
+	return restartWorkloads(ctx, client, store, logf)
+}
+
+// rotateDatabasePasswords changes the MariaDB root password and the password of
+// the app's user. It logs in with the current root password, or with the new
+// one if an interrupted rotation already changed it.
+func (p *HelmProvisioner) rotateDatabasePasswords(ctx context.Context, client kubernetes.Interface, store models.Store, selector, username string, current, next *Credentials, logf LogFunc) error {
+	pod, err := runningPod(ctx, client, store.Namespace, selector)
+	if err != nil {
+		return err
+	}
+	statements := fmt.Sprintf(
+		"ALTER USER IF EXISTS 'root'@'%%' IDENTIFIED BY '%[1]s';\n"+
+			"ALTER USER IF EXISTS 'root'@'localhost' IDENTIFIED BY '%[1]s';\n"+
+			"ALTER USER IF EXISTS '%[2]s'@'%%' IDENTIFIED BY '%[3]s';\n"+
+			"FLUSH PRIVILEGES;\n",
+		next.DatabaseRootPassword, username, next.DatabasePassword)
+	// The root password is read from the first line of stdin so it never shows up in the process list
+	command := []string{"/bin/sh", "-c", `read -r MYSQL_PWD && export MYSQL_PWD && exec mysql -uroot`}
+
+	logf.printf("Changing the database passwords in pod %s", pod.Name)
+	_, err = p.exec(ctx, client, pod, "", command, current.DatabaseRootPassword+"\n"+statements)
+	if err != nil && strings.Contains(err.Error(), "Access denied") {
+		_, err = p.exec(ctx, client, pod, "", command, next.DatabaseRootPassword+"\n"+statements)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to change database passwords: %w", err)
+	}
+	return nil
+}
+
+// rotateAdminPassword sets the admin password with the store type's admin command
+func (p *HelmProvisioner) rotateAdminPassword(ctx context.Context, client kubernetes.Interface, store models.Store, selector string, rotation *CredentialRotation, next *Credentials, logf LogFunc) error {
+	pod, err := runningPod(ctx, client, store.Namespace, selector)
+	if err != nil {
+		return err
+	}
+	command := []string{"/bin/sh", "-c", rotation.AdminCommand, "sh", next.AdminUsername}
+
+	logf.printf("Changing the password of admin user %s in pod %s", next.AdminUsername, pod.Name)
+	if _, err := p.exec(ctx, client, pod, rotation.AdminContainer, command, next.AdminPassword+"\n"); err != nil {
+		return fmt.Errorf("failed to change admin password: %w", err)
+	}
+	return nil
+}
+
+// exec runs a command in a container of the pod, feeding it stdin, and returns its output
+func (p *HelmProvisioner) exec(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod, container string, command []string, stdin string) (string, error) {
+	restConfig, err := p.settings.RESTClientGetter().ToRESTConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	if container == "" {
+		container = pod.Spec.Containers[0].Name
+	}
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(pod.Namespace).
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     true,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewSPDYExecutor(restConfig, "POST", req.URL())
+	if err != nil {
+		return "", fmt.Errorf("failed to exec into pod %s: %w", pod.Name, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  strings.NewReader(stdin),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return "", fmt.Errorf("command in pod %s failed: %w: %s", pod.Name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// runningPod returns a running pod that matches the label selector
+func runningPod(ctx context.Context, client kubernetes.Interface, namespace, selector string) (*corev1.Pod, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	for i := range pods.Items {
+		if pods.Items[i].Status.Phase == corev1.PodRunning && pods.Items[i].DeletionTimestamp == nil {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no running pod matches %s in namespace %s", selector, namespace)
+}
+
+// restartWorkloads rolls every Deployment and StatefulSet of the store and
+// waits until the new pods are ready
+func restartWorkloads(ctx context.Context, client kubernetes.Interface, store models.Store, logf LogFunc) error {
+	ns := store.Namespace
+	patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, RestartedAtAnnotation, time.Now().Format(time.RFC3339)))
+
+	deployments, err := client.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, d := range deployments.Items {
+		if _, err := client.AppsV1().Deployments(ns).Patch(ctx, d.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("failed to restart deployment %s: %w", d.Name, err)
+		}
+		logf.printf("Restarting Deployment/%s", d.Name)
+	}
+	statefulSets, err := client.AppsV1().StatefulSets(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, s := range statefulSets.Items {
+		if _, err := client.AppsV1().StatefulSets(ns).Patch(ctx, s.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("failed to restart statefulset %s: %w", s.Name, err)
+		}
+		logf.printf("Restarting StatefulSet/%s", s.Name)
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, 2*time.Second, helmTimeout, true, func(ctx context.Context) (bool, error) {
+		return rolledOut(ctx, client, ns)
+	})
+	if err != nil {
+		return fmt.Errorf("failed waiting for the restarted pods to become ready: %w", err)
+	}
+	logf.printf("All workloads restarted and ready")
+	return nil
+}
+
+// rolledOut reports whether every Deployment and StatefulSet in the namespace
+// runs its latest pod template on ready pods
+func rolledOut(ctx context.Context, client kubernetes.Interface, namespace string) (bool, error) {
+	deployments, err := client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, d := range deployments.Items {
+		want := int32(1)
+		if d.Spec.Replicas != nil {
+			want = *d.Spec.Replicas
+		}
+		if d.Status.ObservedGeneration < d.Generation || d.Status.UpdatedReplicas < want ||
+			d.Status.AvailableReplicas < want || d.Status.Replicas > d.Status.UpdatedReplicas {
+			return false, nil
+		}
+	}
+	statefulSets, err := client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, s := range statefulSets.Items {
+		want := int32(1)
+		if s.Spec.Replicas != nil {
+			want = *s.Spec.Replicas
+		}
+		if s.Status.ObservedGeneration < s.Generation || s.Status.UpdateRevision != s.Status.CurrentRevision ||
+			s.Status.ReadyReplicas < want {
+			return false, nil
+		}
+	}
+	return true, nil
+}
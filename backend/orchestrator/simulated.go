@@ -0,0 +1,682 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"urumi-backend/models"
+)
+
+// SimFailure is a failure mode the simulated driver can inject into an install
+type SimFailure string
+
+const (
+	SimFailureNone            SimFailure = ""
+	SimFailureImagePull       SimFailure = "image-pull"
+	SimFailureQuota           SimFailure = "quota"
+	SimFailureTimeout         SimFailure = "timeout"
+	SimFailureIngressConflict SimFailure = "ingress-conflict"
+	SimFailureStorage         SimFailure = "storage"
+)
+
+// SimulationConfig tunes the simulated cluster driver
+type SimulationConfig struct {
+	// Latency is how long an install, upgrade or uninstall takes.
+	Latency time.Duration
+	// Timeout is how long an install waits before giving up with SimFailureTimeout.
+	Timeout time.Duration
+	// Failure is injected into installs with probability FailureRate.
+	Failure     SimFailure
+	FailureRate float64
+}
+
+// SimulationConfigFromEnv reads SIM_LATENCY, SIM_TIMEOUT, SIM_FAILURE and SIM_FAILURE_RATE
+func SimulationConfigFromEnv() (SimulationConfig, error) {
+	config := SimulationConfig{
+		Latency:     5 * time.Second,
+		Timeout:     15 * time.Second,
+		Failure:     SimFailure(os.Getenv("SIM_FAILURE")),
+		FailureRate: 1,
+	}
+
+	if v := os.Getenv("SIM_LATENCY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return config, fmt.Errorf("invalid SIM_LATENCY %q: %w", v, err)
+		}
+		config.Latency = d
+	}
+	if v := os.Getenv("SIM_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return config, fmt.Errorf("invalid SIM_TIMEOUT %q: %w", v, err)
+		}
+		config.Timeout = d
+	}
+	if v := os.Getenv("SIM_FAILURE_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return config, fmt.Errorf("invalid SIM_FAILURE_RATE %q: must be between 0 and 1", v)
+		}
+		config.FailureRate = rate
+	}
+
+	switch config.Failure {
+	case SimFailureNone, SimFailureImagePull, SimFailureQuota, SimFailureTimeout, SimFailureIngressConflict, SimFailureStorage:
+	default:
+		return config, fmt.Errorf("invalid SIM_FAILURE %q (expected image-pull, quota, timeout, ingress-conflict or storage)", config.Failure)
+	}
+	return config, nil
+}
+
+type simRelease struct {
+	revision int
+	status   string     // Helm release status: pending-install, deployed, failed
+	phase    string     // Aggregated pod phase
+	reason   string     // Waiting reason reported for the app component, if any
+	history  []Revision // Every revision, oldest first
+}
+
+// simChartVersion is the chart version the simulated releases are deployed with
+const simChartVersion = "0.1.0"
+
+// deploy starts a new revision of the release with the store's spec
+func (rel *simRelease) deploy(store models.Store, status, description string) {
+	vals := map[string]interface{}{"storeId": store.ID}
+	applySpec(store, vals)
+	rel.revision++
+	rel.status = status
+	rel.history = append(rel.history, Revision{
+		Revision:     rel.revision,
+		Status:       status,
+		ChartVersion: simChartVersion,
+		AppVersion:   "1.0.0",
+		ValuesDigest: valuesDigest(vals),
+		Description:  description,
+		UpdatedAt:    time.Now(),
+		Plan:         store.Plan,
+		ImageTag:     store.ImageTag,
+		Values:       store.Values,
+	})
+}
+
+// setStatus changes the status and description of the current revision. Like
+// helm, a newly deployed revision supersedes the one deployed before it.
+func (rel *simRelease) setStatus(status, description string) {
+	rel.status = status
+	for i := range rel.history {
+		if status == "deployed" && rel.history[i].Status == "deployed" {
+			rel.history[i].Status = "superseded"
+		}
+	}
+	current := &rel.history[len(rel.history)-1]
+	current.Status = status
+	current.Description = description
+}
+
+// SimulatedProvisioner fakes releases, namespaces and pod phases in memory.
+// It lets the API and the reconciler run end-to-end without a cluster.
+type SimulatedProvisioner struct {
+	config SimulationConfig
+
+	mu          sync.Mutex
+	namespaces  map[string]string // namespace -> store ID
+	releases    map[string]*simRelease
+	credentials map[string]*Credentials // namespace -> contents of the credentials Secret
+	injected    map[string]SimFailure
+	watchers    []func(storeID string)
+	rng         *rand.Rand
+}
+
+// NewSimulatedProvisioner creates an empty simulated cluster
+func NewSimulatedProvisioner(config SimulationConfig) *SimulatedProvisioner {
+	log.Printf("Using simulated cluster driver (latency %s, failure %q at rate %.2f)", config.Latency, config.Failure, config.FailureRate)
+	return &SimulatedProvisioner{
+		config:      config,
+		namespaces:  make(map[string]string),
+		releases:    make(map[string]*simRelease),
+		credentials: make(map[string]*Credentials),
+		injected:    make(map[string]SimFailure),
+		rng:         rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// InjectFailure forces the next install into the namespace to fail with the given mode
+func (p *SimulatedProvisioner) InjectFailure(namespace string, failure SimFailure) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.injected[namespace] = failure
+}
+
+// DeleteNamespace removes a namespace and its release behind the orchestrator's back, simulating drift
+func (p *SimulatedProvisioner) DeleteNamespace(namespace string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	storeID := p.namespaces[namespace]
+	delete(p.namespaces, namespace)
+	delete(p.releases, namespace)
+	delete(p.credentials, namespace)
+	p.notify(storeID)
+}
+
+// SetPodPhase overrides the aggregated pod phase of a release, simulating drift
+func (p *SimulatedProvisioner) SetPodPhase(namespace, phase string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if rel, ok := p.releases[namespace]; ok {
+		rel.phase = phase
+		p.notify(p.namespaces[namespace])
+	}
+}
+
+// Watch registers notify to be called whenever a simulated store changes
+func (p *SimulatedProvisioner) Watch(ctx context.Context, notify func(storeID string)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.watchers = append(p.watchers, notify)
+	return nil
+}
+
+// notify tells watchers that a store changed; callers must hold p.mu
+func (p *SimulatedProvisioner) notify(storeID string) {
+	if storeID == "" {
+		return
+	}
+	for _, watcher := range p.watchers {
+		watcher(storeID)
+	}
+}
+
+// nextFailure picks the failure (if any) for an install into the namespace
+func (p *SimulatedProvisioner) nextFailure(namespace string) SimFailure {
+	if failure, ok := p.injected[namespace]; ok {
+		delete(p.injected, namespace)
+		return failure
+	}
+	if p.config.Failure != SimFailureNone && p.rng.Float64() < p.config.FailureRate {
+		return p.config.Failure
+	}
+	return SimFailureNone
+}
+
+// Install simulates `helm upgrade --install`
+func (p *SimulatedProvisioner) Install(ctx context.Context, store models.Store, logf LogFunc) error {
+	if err := applyPlan(store, map[string]interface{}{}); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	if _, exists := p.releases[store.Namespace]; exists {
+		p.mu.Unlock()
+		logf.printf("Release %s already exists, upgrading it", store.Namespace)
+		return p.Upgrade(ctx, store, logf)
+	}
+	p.namespaces[store.Namespace] = store.ID
+	newCredentials, err := p.ensureCredentials(store)
+	if err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	rel := &simRelease{phase: "Pending"}
+	rel.deploy(store, "pending-install", "Initial install underway")
+	p.releases[store.Namespace] = rel
+	failure := p.nextFailure(store.Namespace)
+	p.notify(store.ID)
+	p.mu.Unlock()
+
+	if newCredentials {
+		logf.printf("Created secret %s/%s with generated credentials", store.Namespace, CredentialsSecretName)
+	}
+
+	log.Printf("[sim] Installing release %s for store %s", store.Namespace, store.ID)
+	logf.printf("Installing release %s into namespace %s", store.Namespace, store.Namespace)
+	simWaitLog(store, logf)
+
+	switch failure {
+	case SimFailureQuota:
+		err = sleepContext(ctx, p.config.Latency/5)
+		if err == nil {
+			logf.printf("Event Warning FailedCreate StatefulSet/%s-app: create Pod %s-app-0 failed: exceeded quota", store.Namespace, store.Namespace)
+			err = fmt.Errorf(`pods "%s-app-0" is forbidden: exceeded quota: %s, requested: limits.cpu=500m, used: limits.cpu=2, limited: limits.cpu=2`, store.Namespace, store.Namespace)
+		}
+	case SimFailureImagePull:
+		logf.printf("Event Normal Pulling Pod/%s-app-0: Pulling image \"wordpress:latest\"", store.Namespace)
+		err = sleepContext(ctx, p.config.Latency)
+		if err == nil {
+			logf.printf("Event Warning Failed Pod/%s-app-0: Back-off pulling image \"wordpress:latest\"", store.Namespace)
+			err = fmt.Errorf(`timed out waiting for the condition: pod %s-app-0: Back-off pulling image "wordpress:latest": ImagePullBackOff`, store.Namespace)
+		}
+	case SimFailureTimeout:
+		err = sleepContext(ctx, p.config.Timeout)
+		if err == nil {
+			err = fmt.Errorf("timed out waiting for the condition")
+		}
+	case SimFailureIngressConflict:
+		err = sleepContext(ctx, p.config.Latency/5)
+		if err == nil {
+			err = fmt.Errorf(`admission webhook "validate.nginx.ingress.kubernetes.io" denied the request: host "%s.localhost" and path "/" is already defined in ingress default/legacy-store`, store.Namespace)
+		}
+	case SimFailureStorage:
+		err = sleepContext(ctx, p.config.Timeout)
+		if err == nil {
+			logf.printf("Event Warning FailedScheduling Pod/%s-database-0: 0/1 nodes are available: pod has unbound immediate PersistentVolumeClaims", store.Namespace)
+			err = fmt.Errorf("timed out waiting for the condition")
+		}
+	default:
+		err = sleepContext(ctx, p.config.Latency)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.notify(store.ID)
+	if err != nil {
+		rel.setStatus("failed", fmt.Sprintf("Release %q failed: %v", store.Namespace, err))
+		switch failure {
+		case SimFailureQuota:
+			rel.phase = "Unknown" // No pods were admitted
+		case SimFailureImagePull:
+			rel.reason = "ImagePullBackOff"
+		}
+		log.Printf("[sim] Error provision store %s: %v", store.ID, err)
+		return fmt.Errorf("helm install failed: %w", err)
+	}
+	rel.setStatus("deployed", "Install complete")
+	rel.phase = "Running"
+	logf.printf("Release %s is deployed, all resources are ready", store.Namespace)
+	log.Printf("[sim] Successfully provisioned store %s", store.ID)
+	return nil
+}
+
+// Upgrade simulates `helm upgrade` of an existing release
+func (p *SimulatedProvisioner) Upgrade(ctx context.Context, store models.Store, logf LogFunc) error {
+	if err := applyPlan(store, map[string]interface{}{}); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	rel, exists := p.releases[store.Namespace]
+	if !exists {
+		p.mu.Unlock()
+		return fmt.Errorf("helm upgrade failed: %w", ErrReleaseNotFound)
+	}
+	rel.deploy(store, "pending-upgrade", "Preparing upgrade")
+	p.mu.Unlock()
+
+	if store.Plan != "" {
+		logf.printf("Upgrading release %s to revision %d with plan %s", store.Namespace, rel.revision, store.Plan)
+	} else {
+		logf.printf("Upgrading release %s to revision %d", store.Namespace, rel.revision)
+	}
+	if store.ImageTag != "" {
+		logf.printf("Using image tag %s", store.ImageTag)
+	}
+	for _, key := range sortedKeys(store.Values) {
+		logf.printf("Setting %s=%v", key, store.Values[key])
+	}
+	simWaitLog(store, logf)
+	err := sleepContext(ctx, p.config.Latency)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.notify(store.ID)
+	if err != nil {
+		rel.setStatus("failed", fmt.Sprintf("Upgrade %q failed: %v", store.Namespace, err))
+		return fmt.Errorf("helm upgrade failed: %w", err)
+	}
+	rel.setStatus("deployed", "Upgrade complete")
+	rel.phase = "Running"
+	logf.printf("Release %s is deployed, all resources are ready", store.Namespace)
+	log.Printf("[sim] Successfully upgraded store %s to revision %d", store.ID, rel.revision)
+	return nil
+}
+
+// Revisions lists the simulated release history, newest first
+func (p *SimulatedProvisioner) Revisions(ctx context.Context, store models.Store) ([]Revision, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rel, ok := p.releases[store.Namespace]
+	if !ok {
+		return nil, ErrReleaseNotFound
+	}
+	revisions := make([]Revision, 0, len(rel.history))
+	for i := len(rel.history) - 1; i >= 0; i-- {
+		revisions = append(revisions, rel.history[i])
+	}
+	return revisions, nil
+}
+
+// Rollback simulates `helm rollback`: a new revision with the spec of the target revision
+func (p *SimulatedProvisioner) Rollback(ctx context.Context, store models.Store, revision int, logf LogFunc) error {
+	p.mu.Lock()
+	rel, ok := p.releases[store.Namespace]
+	if !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("helm rollback failed: %w", ErrReleaseNotFound)
+	}
+	target, err := findRevision(rel.history, revision)
+	if err != nil {
+		p.mu.Unlock()
+		return fmt.Errorf("helm rollback failed: %w", err)
+	}
+	store.Plan, store.ImageTag, store.Values = target.Plan, target.ImageTag, target.Values
+	rel.deploy(store, "pending-rollback", fmt.Sprintf("Rollback to %d", revision))
+	rel.phase = "Pending"
+	p.notify(store.ID)
+	p.mu.Unlock()
+
+	logf.printf("Rolling back release %s to revision %d", store.Namespace, revision)
+	simWaitLog(store, logf)
+	err = sleepContext(ctx, p.config.Latency)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.notify(store.ID)
+	if err != nil {
+		rel.setStatus("failed", fmt.Sprintf("Rollback %q failed: %v", store.Namespace, err))
+		return fmt.Errorf("helm rollback failed: %w", err)
+	}
+	rel.setStatus("deployed", fmt.Sprintf("Rollback to %d", revision))
+	rel.phase = "Running"
+	logf.printf("Release %s is deployed, all resources are ready", store.Namespace)
+	log.Printf("[sim] Successfully rolled back store %s to revision %d", store.ID, revision)
+	return nil
+}
+
+// Render renders a simplified manifest of the store's resources and diffs it
+// against the manifest of the deployed revision
+func (p *SimulatedProvisioner) Render(ctx context.Context, store models.Store) (*Preview, error) {
+	vals, err := simValues(store)
+	if err != nil {
+		return nil, err
+	}
+	preview := &Preview{Values: vals, Manifest: redactManifest(simManifest(store))}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rel, ok := p.releases[store.Namespace]
+	if !ok {
+		return preview, nil
+	}
+	current := rel.history[len(rel.history)-1]
+	deployed := store
+	deployed.Plan, deployed.ImageTag, deployed.Values = current.Plan, current.ImageTag, current.Values
+	preview.DeployedRevision = current.Revision
+	from := fmt.Sprintf("revision %d (%s)", current.Revision, current.Status)
+	diff, err := diffManifests(redactManifest(simManifest(deployed)), preview.Manifest, from, "preview")
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff manifests: %w", err)
+	}
+	preview.Diff = diff
+	return preview, nil
+}
+
+// simValues computes the chart values a simulated release is deployed with
+func simValues(store models.Store) (map[string]interface{}, error) {
+	vals := map[string]interface{}{"storeId": store.ID}
+	if err := applyPlan(store, vals); err != nil {
+		return nil, err
+	}
+	applySpec(store, vals)
+	setValue(vals, "ingress.host", fmt.Sprintf("%s.%s", store.Namespace, domainSuffix()))
+	return vals, nil
+}
+
+// simManifest renders the resources a simulated release stands for
+func simManifest(store models.Store) string {
+	tag := store.ImageTag
+	if tag == "" {
+		tag = "latest"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "---\n# Source: %s/templates/secret.yaml\napiVersion: v1\nkind: Secret\nmetadata:\n  name: %s\n  namespace: %s\ndata:\n", store.Type, CredentialsSecretName, store.Namespace)
+	for _, key := range []string{secretKeyAdminUsername, secretKeyAdminPassword, secretKeyDBPassword, secretKeyRootPassword} {
+		fmt.Fprintf(&b, "  %s: c2ltdWxhdGVk\n", key)
+	}
+	if len(store.Values) > 0 {
+		fmt.Fprintf(&b, "---\n# Source: %s/templates/configmap-values.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s-values\n  namespace: %s\ndata:\n", store.Type, store.Namespace, store.Namespace)
+		for _, key := range sortedKeys(store.Values) {
+			fmt.Fprintf(&b, "  %s: %q\n", key, fmt.Sprint(store.Values[key]))
+		}
+	}
+	// Without a plan the chart's own sizes apply, which the simulation doesn't know
+	plan, err := LookupStorePlan(store.Type, store.Plan)
+	hasPlan := store.Plan != "" && err == nil
+	for _, component := range componentsOf(store.Type) {
+		image, resources := store.Type+":"+tag, plan.App
+		if component.Kind == "StatefulSet" {
+			image, resources = "mariadb:latest", plan.Database
+		}
+		fmt.Fprintf(&b, "---\n# Source: %s/templates/%s.yaml\napiVersion: apps/v1\nkind: %s\nmetadata:\n  name: %s-%s\n  namespace: %s\n  labels:\n    %s: %s\nspec:\n  replicas: 1\n  template:\n    spec:\n      containers:\n        - name: %s\n          image: %s\n",
+			store.Type, component.Name, component.Kind, store.Namespace, component.Name, store.Namespace, StoreIDLabel, store.ID, component.Name, image)
+		if !hasPlan {
+			continue
+		}
+		fmt.Fprintf(&b, "          resources:\n            requests:\n              cpu: %s\n              memory: %s\n            limits:\n              cpu: %s\n              memory: %s\n",
+			resources.Requests.CPU, resources.Requests.Memory, resources.Limits.CPU, resources.Limits.Memory)
+	}
+	if t, _ := LookupStoreType(store.Type); hasPlan && t.PlanValues["quota.pods"] != "" {
+		fmt.Fprintf(&b, "---\n# Source: %s/templates/resourcequota.yaml\napiVersion: v1\nkind: ResourceQuota\nmetadata:\n  name: %s-quota\n  namespace: %s\nspec:\n  hard:\n    pods: %q\n    requests.cpu: %s\n    requests.memory: %s\n    requests.storage: %s\n    limits.cpu: %s\n    limits.memory: %s\n    persistentvolumeclaims: %q\n",
+			store.Type, store.Namespace, store.Namespace, plan.Quota.Pods, plan.Quota.RequestsCPU, plan.Quota.RequestsMemory, plan.Quota.RequestsStorage, plan.Quota.LimitsCPU, plan.Quota.LimitsMemory, plan.Quota.PVCs)
+	}
+	fmt.Fprintf(&b, "---\n# Source: %s/templates/ingress.yaml\napiVersion: networking.k8s.io/v1\nkind: Ingress\nmetadata:\n  name: %s\n  namespace: %s\nspec:\n  rules:\n    - host: %s.%s\n", store.Type, store.Namespace, store.Namespace, store.Namespace, domainSuffix())
+	return b.String()
+}
+
+// Uninstall simulates removing the release and deleting the namespace
+func (p *SimulatedProvisioner) Uninstall(ctx context.Context, store models.Store) error {
+	if err := sleepContext(ctx, p.config.Latency/2); err != nil {
+		return fmt.Errorf("failed waiting for namespace %s to be deleted: %w", store.Namespace, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if creds, ok := p.credentials[store.Namespace]; ok {
+		creds.unregister()
+	}
+	delete(p.releases, store.Namespace)
+	delete(p.namespaces, store.Namespace)
+	delete(p.credentials, store.Namespace)
+	p.notify(store.ID)
+	log.Printf("[sim] Successfully deleted namespace %s for store %s", store.Namespace, store.ID)
+	return nil
+}
+
+// Status reports the simulated release status and pod phase
+func (p *SimulatedProvisioner) Status(ctx context.Context, store models.Store) (*StoreStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, nsExists := p.namespaces[store.Namespace]
+	status := &StoreStatus{NamespaceExists: nsExists, Phase: "Unknown"}
+	if rel, ok := p.releases[store.Namespace]; ok {
+		status.Release = rel.status
+		status.Phase = rel.phase
+		status.Components = simComponents(store.Type, rel)
+		if rel.status == "deployed" {
+			status.Ingresses = []IngressStatus{{Name: store.Namespace, Address: "127.0.0.1"}}
+		}
+	}
+	return status, nil
+}
+
+// simWaitLog writes the lines helm prints while waiting for the store's resources
+func simWaitLog(store models.Store, logf LogFunc) {
+	components := componentsOf(store.Type)
+	logf.printf("beginning wait for %d resources with timeout of %s", len(components), helmTimeout)
+	for _, component := range components {
+		logf.printf("%s is not ready: %s/%s-%s. 0 out of 1 expected pods are ready", component.Kind, store.Namespace, store.Namespace, component.Name)
+	}
+}
+
+// simComponents fakes the readiness of the store type's required components from the release phase
+func simComponents(storeType string, rel *simRelease) []ComponentStatus {
+	if rel.phase == "Unknown" {
+		return nil
+	}
+	var components []ComponentStatus
+	for _, component := range componentsOf(storeType) {
+		status := ComponentStatus{Name: component.Name, Kind: component.Kind, Required: true, Ready: rel.phase == "Running"}
+		switch {
+		case status.Ready:
+		case rel.phase == "Failed":
+			status.Reason = "CrashLoopBackOff"
+			status.Restarts = crashLoopRestarts
+		case rel.reason != "" && component.Name == "app":
+			status.Reason = rel.reason
+		default:
+			status.Reason = "NotReady"
+		}
+		components = append(components, status)
+	}
+	return components
+}
+
+// Resources lists the simulated namespace, release and the objects the chart would create
+func (p *SimulatedProvisioner) Resources(ctx context.Context, store models.Store) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.namespaces[store.Namespace]; !ok {
+		return nil, nil
+	}
+	resources := []string{"Namespace/" + store.Namespace}
+	if _, ok := p.releases[store.Namespace]; ok {
+		resources = append(resources, "HelmRelease/"+store.Namespace)
+		for _, component := range componentsOf(store.Type) {
+			resources = append(resources, fmt.Sprintf("%s/%s-%s", component.Kind, store.Namespace, component.Name))
+			if component.Kind == "StatefulSet" {
+				resources = append(resources, fmt.Sprintf("PersistentVolumeClaim/data-%s-%s-0", store.Namespace, component.Name))
+			}
+		}
+	}
+	return resources, nil
+}
+
+// ensureCredentials generates the store's credentials unless the namespace
+// already has them, reporting whether it did; callers must hold p.mu
+func (p *SimulatedProvisioner) ensureCredentials(store models.Store) (bool, error) {
+	if _, ok := p.credentials[store.Namespace]; ok {
+		return false, nil
+	}
+	creds, err := generateCredentials()
+	if err != nil {
+		return false, err
+	}
+	p.credentials[store.Namespace] = creds
+	return true, nil
+}
+
+// Credentials returns the simulated contents of the store's credentials Secret
+func (p *SimulatedProvisioner) Credentials(ctx context.Context, store models.Store) (*Credentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	creds, ok := p.credentials[store.Namespace]
+	if !ok {
+		return nil, ErrCredentialsNotFound
+	}
+	copied := *creds
+	return &copied, nil
+}
+
+// RotateCredentials simulates replacing the store's passwords and restarting its pods
+func (p *SimulatedProvisioner) RotateCredentials(ctx context.Context, store models.Store, logf LogFunc) error {
+	p.mu.Lock()
+	current, ok := p.credentials[store.Namespace]
+	rel, deployed := p.releases[store.Namespace]
+	// Copied while locked, the release and credentials change under p.mu
+	deployed = deployed && rel.status == "deployed"
+	var adminUsername string
+	if ok {
+		adminUsername = current.AdminUsername
+	}
+	p.mu.Unlock()
+	if !ok {
+		return ErrCredentialsNotFound
+	}
+	if !deployed {
+		return fmt.Errorf("store %s has no deployed release to rotate credentials of", store.ID)
+	}
+
+	next, err := generateCredentials()
+	if err != nil {
+		return err
+	}
+	next.AdminUsername = adminUsername
+	logf.printf("Generated new credentials")
+	if t, _ := LookupStoreType(store.Type); t.CredentialRotation != nil {
+		if t.CredentialRotation.DatabaseUsername != "" {
+			logf.printf("Changing the database passwords in pod %s-database-0", store.Namespace)
+		}
+		if t.CredentialRotation.AdminCommand != "" {
+			logf.printf("Changing the password of admin user %s", next.AdminUsername)
+		}
+	}
+	if err := sleepContext(ctx, p.config.Latency/2); err != nil {
+		return fmt.Errorf("failed to rotate credentials: %w", err)
+	}
+
+	p.mu.Lock()
+	p.credentials[store.Namespace] = next
+	current.unregister()
+	rel.phase = "Pending"
+	p.notify(store.ID)
+	p.mu.Unlock()
+	logf.printf("Updated secret %s/%s", store.Namespace, CredentialsSecretName)
+	for _, component := range componentsOf(store.Type) {
+		logf.printf("Restarting %s/%s-%s", component.Kind, store.Namespace, component.Name)
+	}
+
+	err = sleepContext(ctx, p.config.Latency/2)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.notify(store.ID)
+	rel.phase = "Running"
+	if err != nil {
+		return fmt.Errorf("failed waiting for the restarted pods to become ready: %w", err)
+	}
+	logf.printf("All workloads restarted and ready")
+	return nil
+}
+
+// CheckHealth reports healthy once the release is deployed and its pods are running
+func (p *SimulatedProvisioner) CheckHealth(ctx context.Context, store models.Store) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rel, ok := p.releases[store.Namespace]
+	if !ok {
+		return false, fmt.Errorf("no release for store %s", store.ID)
+	}
+	if rel.status != "deployed" || rel.phase != "Running" {
+		return false, fmt.Errorf("store %s is not serving (release %s, pods %s)", store.ID, rel.status, rel.phase)
+	}
+	return true, nil
+}
+
+// sleepContext waits for d or until ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// sortedKeys returns the keys of the chart values in order, for stable logs
+func sortedKeys(values models.ChartValues) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
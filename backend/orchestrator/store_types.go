@@ -0,0 +1,270 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// ErrUnknownStoreType is returned for a store type that is not in the catalog
+var ErrUnknownStoreType = errors.New("unknown store type")
+
+// StoreType is a kind of store the orchestrator can provision, as declared in
+// the store-type catalog
+type StoreType struct {
+	Name        string    `json:"name"`
+	DisplayName string    `json:"display_name"`
+	Description string    `json:"description,omitempty"`
+	Chart       ChartSpec `json:"chart"`
+	// ValuesFiles maps an environment to the values file layered over the chart's values.yaml
+	ValuesFiles     map[string]string `json:"values_files,omitempty"`
+	HealthCheckPath string            `json:"health_check_path"` // Path on the store URL that answers 200 when the store serves
+	Components      []Component       `json:"components"`
+	Parameters      []Parameter       `json:"parameters,omitempty"`
+	// PlanValues maps plan fields, such as app.limits.cpu or database_storage, to
+	// the chart values they set. Types without it don't support plans.
+	PlanValues   map[string]string `json:"plan_values,omitempty"`
+	PodSelectors PodSelectors      `json:"pod_selectors,omitempty"`
+	// CredentialRotation says how the passwords of types that change them in
+	// place on rotation are changed; other types only get a new Secret and a restart.
+	CredentialRotation *CredentialRotation `json:"credential_rotation,omitempty"`
+}
+
+// CredentialRotation describes how a store type's passwords are changed in the
+// running store
+type CredentialRotation struct {
+	// DatabaseUsername is the MariaDB user the app connects as; its password and
+	// root's are changed in the database pod
+	DatabaseUsername string `json:"database_username,omitempty"`
+	// AdminCommand is a shell script run in the app pod that sets the admin
+	// password. It gets the admin username as $1 and the password on stdin.
+	AdminCommand   string `json:"admin_command,omitempty"`
+	AdminContainer string `json:"admin_container,omitempty"` // Container AdminCommand runs in, the pod's first by default
+}
+
+// PodSelectors are label selectors for the pods of a store, and the volume
+// claims that carry the same labels
+type PodSelectors struct {
+	App      string `json:"app,omitempty"`      // Pods serving the store
+	Database string `json:"database,omitempty"` // Database pods, and the claims of their volumes
+}
+
+// ChartSpec locates a store type's Helm chart
+type ChartSpec struct {
+	Path    string `json:"path"`              // Chart directory, relative to the catalog file
+	Version string `json:"version,omitempty"` // Semver constraint the chart's version must satisfy
+}
+
+// StoreTypeCatalog is the set of store types stores can be created with
+type StoreTypeCatalog struct {
+	Types []StoreType `json:"types"`
+
+	dir string // Directory of the catalog file, chart paths are relative to it
+}
+
+// storeTypes is loaded by ConfigureStoreTypesFromEnv at startup
+var storeTypes StoreTypeCatalog
+
+// storeTypeName matches a store type name; it ends up in image names and labels
+var storeTypeName = regexp.MustCompile(`^[a-z][a-z0-9-]{0,30}$`)
+
+// ConfigureStoreTypesFromEnv loads the store-type catalog from STORE_TYPES_FILE,
+// or from store-types.yaml in the charts directory
+func ConfigureStoreTypesFromEnv() error {
+	path := os.Getenv("STORE_TYPES_FILE")
+	if path == "" {
+		dir, err := chartsDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(dir, "store-types.yaml")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read store-type catalog: %w", err)
+	}
+	var catalog StoreTypeCatalog
+	if err := yaml.UnmarshalStrict(data, &catalog); err != nil {
+		return fmt.Errorf("invalid store-type catalog %s: %w", path, err)
+	}
+	catalog.dir = filepath.Dir(path)
+	if err := catalog.validate(); err != nil {
+		return fmt.Errorf("invalid store-type catalog %s: %w", path, err)
+	}
+	storeTypes = catalog
+	return nil
+}
+
+// validate checks every store type, so a broken catalog fails at startup
+// rather than when a store is created
+func (c StoreTypeCatalog) validate() error {
+	if len(c.Types) == 0 {
+		return errors.New("no store types defined")
+	}
+	seen := make(map[string]bool)
+	for _, t := range c.Types {
+		if !storeTypeName.MatchString(t.Name) {
+			return fmt.Errorf("invalid store type name %q: use lowercase letters, digits and dashes", t.Name)
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("store type %s is defined twice", t.Name)
+		}
+		seen[t.Name] = true
+		if err := t.validate(c.dir); err != nil {
+			return fmt.Errorf("store type %s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+func (t StoreType) validate(dir string) error {
+	if t.Chart.Path == "" {
+		return errors.New("chart.path is required")
+	}
+	if _, err := os.Stat(t.chartPath(dir)); err != nil {
+		return fmt.Errorf("chart.path: %w", err)
+	}
+	if t.Chart.Version != "" {
+		if _, err := semver.NewConstraint(t.Chart.Version); err != nil {
+			return fmt.Errorf("chart.version: %w", err)
+		}
+	}
+	for env, file := range t.ValuesFiles {
+		if file == "" {
+			return fmt.Errorf("values_files.%s is empty", env)
+		}
+	}
+	if !strings.HasPrefix(t.HealthCheckPath, "/") {
+		return fmt.Errorf("health_check_path %q must start with /", t.HealthCheckPath)
+	}
+
+	if len(t.Components) == 0 {
+		return errors.New("at least one component is required")
+	}
+	components := make(map[string]bool)
+	for _, component := range t.Components {
+		if component.Name == "" || components[component.Name] {
+			return fmt.Errorf("component names must be set and unique, got %q", component.Name)
+		}
+		components[component.Name] = true
+		if component.Kind != "Deployment" && component.Kind != "StatefulSet" {
+			return fmt.Errorf("component %s: kind must be Deployment or StatefulSet", component.Name)
+		}
+		if _, err := labels.Parse(component.Selector); err != nil || component.Selector == "" {
+			return fmt.Errorf("component %s: invalid selector %q", component.Name, component.Selector)
+		}
+	}
+
+	for name, selector := range map[string]string{"app": t.PodSelectors.App, "database": t.PodSelectors.Database} {
+		if _, err := labels.Parse(selector); err != nil {
+			return fmt.Errorf("pod_selectors.%s: invalid selector %q", name, selector)
+		}
+	}
+	if r := t.CredentialRotation; r != nil {
+		if r.DatabaseUsername == "" && r.AdminCommand == "" {
+			return errors.New("credential_rotation needs database_username or admin_command")
+		}
+		if r.DatabaseUsername != "" && t.PodSelectors.Database == "" {
+			return errors.New("credential_rotation.database_username needs pod_selectors.database")
+		}
+		if r.AdminCommand != "" && t.PodSelectors.App == "" {
+			return errors.New("credential_rotation.admin_command needs pod_selectors.app")
+		}
+	}
+
+	fields := Plan{}.fields()
+	for field, path := range t.PlanValues {
+		if _, ok := fields[field]; !ok {
+			return fmt.Errorf("plan_values: unknown plan field %q", field)
+		}
+		if path == "" {
+			return fmt.Errorf("plan_values.%s is empty", field)
+		}
+	}
+
+	parameters := make(map[string]bool)
+	for _, parameter := range t.Parameters {
+		if parameter.Key == "" || parameters[parameter.Key] {
+			return fmt.Errorf("parameter keys must be set and unique, got %q", parameter.Key)
+		}
+		parameters[parameter.Key] = true
+		switch parameter.Type {
+		case "string", "integer", "boolean":
+		default:
+			return fmt.Errorf("parameter %s: type must be string, integer or boolean", parameter.Key)
+		}
+	}
+	return nil
+}
+
+// chartPath resolves the chart directory against the catalog's directory
+func (t StoreType) chartPath(dir string) string {
+	if filepath.IsAbs(t.Chart.Path) {
+		return t.Chart.Path
+	}
+	return filepath.Join(dir, t.Chart.Path)
+}
+
+// StoreTypes returns the store types in the catalog
+func StoreTypes() []StoreType {
+	return storeTypes.Types
+}
+
+// LookupStoreType returns the store type with the given name
+func LookupStoreType(name string) (StoreType, error) {
+	names := make([]string, 0, len(storeTypes.Types))
+	for _, t := range storeTypes.Types {
+		if t.Name == name {
+			return t, nil
+		}
+		names = append(names, t.Name)
+	}
+	return StoreType{}, fmt.Errorf("%w %q (available: %s)", ErrUnknownStoreType, name, strings.Join(names, ", "))
+}
+
+// checkChartVersion checks a chart version against the catalog's constraint
+func checkChartVersion(version, constraint string) error {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return fmt.Errorf("invalid chart version constraint %q: %w", constraint, err)
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return fmt.Errorf("invalid chart version %q: %w", version, err)
+	}
+	if !c.Check(v) {
+		return fmt.Errorf("chart version %s does not satisfy %s", version, constraint)
+	}
+	return nil
+}
+
+// component returns the store type's component with the given name
+func (t StoreType) component(name string) (Component, bool) {
+	for _, c := range t.Components {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Component{}, false
+}
+
+// componentsOf returns the components a store type needs to be ready
+func componentsOf(storeType string) []Component {
+	t, _ := LookupStoreType(storeType)
+	return t.Components
+}
+
+// storeEnvironment is the environment whose values files are used (default: local)
+func storeEnvironment() string {
+	if env := os.Getenv("STORE_ENVIRONMENT"); env != "" {
+		return env
+	}
+	return "local"
+}
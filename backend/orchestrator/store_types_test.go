@@ -0,0 +1,82 @@
+package orchestrator
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShippedStoreTypeCatalog(t *testing.T) {
+	saved := storeTypes
+	t.Cleanup(func() { storeTypes = saved })
+	t.Setenv("STORE_TYPES_FILE", filepath.Join("..", "..", "charts", "store-types.yaml"))
+	if err := ConfigureStoreTypesFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+
+	woocommerce, err := LookupStoreType("woocommerce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := woocommerce.CredentialRotation; r == nil || r.DatabaseUsername != "wordpress" || r.AdminCommand == "" {
+		t.Fatalf("woocommerce does not rotate the wordpress database user and admin password: %+v", r)
+	}
+	if woocommerce.PodSelectors.Database == "" || woocommerce.PlanValues[planFieldDatabaseStorage] == "" {
+		t.Fatalf("woocommerce lacks a database pod selector or a database volume plan value: %+v", woocommerce)
+	}
+	medusa, err := LookupStoreType("medusa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if medusa.CredentialRotation != nil || medusa.PodSelectors.Database != "" {
+		t.Fatalf("medusa has no database, but declares one: %+v", medusa)
+	}
+}
+
+func TestStoreTypeValidation(t *testing.T) {
+	valid := func() StoreType {
+		return StoreType{
+			Name:            "woocommerce",
+			Chart:           ChartSpec{Path: "woocommerce"},
+			HealthCheckPath: "/",
+			Components:      []Component{{Name: "app", Kind: "Deployment", Selector: "app.kubernetes.io/name=woocommerce-store"}},
+			PodSelectors:    PodSelectors{App: "app.kubernetes.io/name=woocommerce-store", Database: "app.kubernetes.io/name=mariadb"},
+			PlanValues:      map[string]string{"app.limits.cpu": "resources.limits.cpu"},
+		}
+	}
+	tests := []struct {
+		name    string
+		change  func(*StoreType)
+		wantErr string
+	}{
+		{"valid", func(*StoreType) {}, ""},
+		{"credential rotation", func(st *StoreType) {
+			st.CredentialRotation = &CredentialRotation{DatabaseUsername: "wordpress", AdminCommand: "wp user update \"$1\""}
+		}, ""},
+		{"admin rotation without a database", func(st *StoreType) {
+			st.CredentialRotation = &CredentialRotation{AdminCommand: "wp user update \"$1\""}
+			st.PodSelectors.Database = ""
+		}, ""},
+		{"database rotation without a database", func(st *StoreType) {
+			st.CredentialRotation = &CredentialRotation{DatabaseUsername: "wordpress"}
+			st.PodSelectors.Database = ""
+		}, "database_username needs pod_selectors.database"},
+		{"empty credential rotation", func(st *StoreType) { st.CredentialRotation = &CredentialRotation{} }, "credential_rotation needs"},
+		{"invalid pod selector", func(st *StoreType) { st.PodSelectors.App = "app in (" }, "pod_selectors.app"},
+		{"unknown plan field", func(st *StoreType) { st.PlanValues["app.limits.gpu"] = "resources.limits.gpu" }, "unknown plan field"},
+		{"empty plan value", func(st *StoreType) { st.PlanValues["app_storage"] = "" }, "plan_values.app_storage is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := valid()
+			tt.change(&st)
+			err := st.validate(filepath.Join("..", "..", "charts"))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("validate = %v, want no error", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("validate = %v, want an error about %q", err, tt.wantErr)
+			}
+		})
+	}
+}
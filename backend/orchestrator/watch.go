@@ -0,0 +1,79 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Watch starts shared informers on the namespaces, deployments, pods and ingresses
+// labelled with StoreIDLabel and notifies the store they belong to on every change
+func (p *HelmProvisioner) Watch(ctx context.Context, notify func(storeID string)) error {
+	client, err := p.kubeClient()
+	if err != nil {
+		return err
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = StoreIDLabel
+		}),
+	)
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			notifyStore(obj, notify)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldMeta, err1 := meta.Accessor(oldObj)
+			newMeta, err2 := meta.Accessor(newObj)
+			if err1 == nil && err2 == nil && oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+				return
+			}
+			notifyStore(newObj, notify)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			notifyStore(obj, notify)
+		},
+	}
+
+	for _, informer := range []cache.SharedIndexInformer{
+		factory.Core().V1().Namespaces().Informer(),
+		factory.Apps().V1().Deployments().Informer(),
+		factory.Core().V1().Pods().Informer(),
+		factory.Networking().V1().Ingresses().Informer(),
+	} {
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			return fmt.Errorf("failed to register informer handler: %w", err)
+		}
+	}
+
+	factory.Start(ctx.Done())
+	for informerType, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to sync informer for %v", informerType)
+		}
+	}
+
+	log.Printf("Watching store namespaces, deployments, pods and ingresses")
+	return nil
+}
+
+// notifyStore extracts the store ID label from a watched object
+func notifyStore(obj interface{}, notify func(storeID string)) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	if storeID := accessor.GetLabels()[StoreIDLabel]; storeID != "" {
+		notify(storeID)
+	}
+}
@@ -0,0 +1,128 @@
+// Package redact masks credentials in text before it is logged, stored or
+// returned by the API.
+package redact
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask replaces every redacted value
+const Mask = "[REDACTED]"
+
+// minSecretLength keeps short values from masking ordinary words
+const minSecretLength = 8
+
+var (
+	mu      sync.RWMutex
+	secrets = map[string]struct{}{}
+	// ordered holds the registered secrets longest first, so a secret that
+	// contains another one is masked as a whole
+	ordered []string
+)
+
+// sensitiveValue matches the value of a key that looks like a credential, as in
+// `mariadb.auth.rootPassword=...`, `"password": "..."` or `token: ...`
+var sensitiveValue = regexp.MustCompile(`(?i)([\w.\-\[\]]*(?:password|passwd|pwd|secret|token|api[_-]?key|private[_-]?key|credentials?)[\w.\-\[\]]*"?\s*[=:]\s*"?)([^\s",'}&]+)`)
+
+// bearerToken matches an Authorization header value
+var bearerToken = regexp.MustCompile(`(?i)(bearer\s+)[\w\-.~+/]+=*`)
+
+// Register adds values, such as generated passwords, that must be masked
+// wherever they appear, even outside a key=value pair
+func Register(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	changed := false
+	for _, v := range values {
+		if len(v) < minSecretLength {
+			continue
+		}
+		if _, ok := secrets[v]; ok {
+			continue
+		}
+		secrets[v] = struct{}{}
+		changed = true
+	}
+	if changed {
+		reorder()
+	}
+}
+
+// Unregister stops masking values that are no longer in use, such as the
+// passwords of a deleted store or the old ones after a rotation
+func Unregister(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	changed := false
+	for _, v := range values {
+		if _, ok := secrets[v]; !ok {
+			continue
+		}
+		delete(secrets, v)
+		changed = true
+	}
+	if changed {
+		reorder()
+	}
+}
+
+// reorder rebuilds ordered from secrets; mu must be held for writing
+func reorder() {
+	ordered = ordered[:0]
+	for v := range secrets {
+		ordered = append(ordered, v)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return len(ordered[i]) > len(ordered[j]) })
+}
+
+// String masks registered secrets and the values of credential-like keys in s
+func String(s string) string {
+	if s == "" {
+		return s
+	}
+	mu.RLock()
+	for _, v := range ordered {
+		s = strings.ReplaceAll(s, v, Mask)
+	}
+	mu.RUnlock()
+	s = sensitiveValue.ReplaceAllStringFunc(s, func(match string) string {
+		parts := sensitiveValue.FindStringSubmatch(match)
+		if parts[2] == Mask {
+			return match
+		}
+		return parts[1] + Mask
+	})
+	return bearerToken.ReplaceAllString(s, "${1}"+Mask)
+}
+
+// Error returns the redacted message of err, or "" for a nil error
+func Error(err error) string {
+	if err == nil {
+		return ""
+	}
+	return String(err.Error())
+}
+
+// writer redacts everything written through it
+type writer struct {
+	w io.Writer
+}
+
+// NewWriter wraps w so that whatever is written to it is redacted first. The
+// standard logger writes each entry in one call, so log.SetOutput(NewWriter(...))
+// redacts every log line.
+func NewWriter(w io.Writer) io.Writer {
+	return &writer{w: w}
+}
+
+func (r *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	// Report the original length, callers only care that all of p was consumed
+	return len(p), nil
+}
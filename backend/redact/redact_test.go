@@ -0,0 +1,102 @@
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestStringMasksCredentialKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		secret string
+	}{
+		{"helm set flag", "helm upgrade --install s1 ./charts/woocommerce --set mariadb.auth.rootPassword=Zq81mKd0aPw3Lx2c", "Zq81mKd0aPw3Lx2c"},
+		{"set with more flags", "--set wordpress.db.password=hunter22 --set storeId=abc", "hunter22"},
+		{"json", `{"rootPassword": "s3cr3t-value", "host": "x"}`, "s3cr3t-value"},
+		{"yaml", "auth:\n  password: yamlpass99\n", "yamlpass99"},
+		{"token", "token=abcdef123456", "abcdef123456"},
+		{"api key", "API_KEY: key-0987654321", "key-0987654321"},
+		{"bearer", "Authorization: Bearer eyJhbGciOi.J9.sig", "eyJhbGciOi.J9.sig"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := String(tt.in)
+			if strings.Contains(got, tt.secret) {
+				t.Errorf("String(%q) = %q, still contains the secret", tt.in, got)
+			}
+			if !strings.Contains(got, Mask) {
+				t.Errorf("String(%q) = %q, want it masked", tt.in, got)
+			}
+		})
+	}
+}
+
+func TestStringKeepsOrdinaryText(t *testing.T) {
+	for _, in := range []string{
+		"helm install failed: timed out waiting for the condition",
+		"certificate secret store-abc-tls not issued",
+		"Installing release store-abc (chart woocommerce 0.1.0) into namespace store-abc",
+	} {
+		if got := String(in); got != in {
+			t.Errorf("String(%q) = %q, want it unchanged", in, got)
+		}
+	}
+}
+
+func TestRegisteredSecretsAreMaskedAnywhere(t *testing.T) {
+	const secret = "Kx9rT2mWq7LpZ4vB"
+	Register(secret, "short")
+
+	in := "Error: INSTALLATION FAILED: template: mariadb/templates/secret.yaml:12: bad value " + secret
+	if got := String(in); strings.Contains(got, secret) {
+		t.Errorf("String(%q) = %q, still contains the registered secret", in, got)
+	}
+	// Values too short to be a generated secret are not registered
+	if got := String("a short answer"); got != "a short answer" {
+		t.Errorf("short value was masked: %q", got)
+	}
+}
+
+func TestUnregisteredSecretsAreNoLongerMasked(t *testing.T) {
+	const old, current = "Old7secretPassw0rd", "Cur7secretPassw0rd"
+	Register(old, current)
+	Unregister(old, "never-registered")
+
+	if got := String("was " + old); got != "was "+old {
+		t.Errorf("unregistered secret is still masked: %q", got)
+	}
+	if got := String("is " + current); strings.Contains(got, current) {
+		t.Errorf("String() = %q, the secret that is still registered leaked", got)
+	}
+	Unregister(current)
+	if got := String("is " + current); got != "is "+current {
+		t.Errorf("unregistered secret is still masked: %q", got)
+	}
+}
+
+func TestError(t *testing.T) {
+	if got := Error(nil); got != "" {
+		t.Errorf("Error(nil) = %q, want empty", got)
+	}
+	err := errors.New("failed to apply chart override: mariadb.auth.password=Mp4ssw0rdXYZ")
+	if got := Error(err); strings.Contains(got, "Mp4ssw0rdXYZ") {
+		t.Errorf("Error() = %q, still contains the secret", got)
+	}
+}
+
+func TestWriterRedactsLogOutput(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(NewWriter(&buf), "", 0)
+	logger.Printf("Error provision store %s: %v", "s1", errors.New("--set mariadb.auth.rootPassword=RootPass1234"))
+
+	if strings.Contains(buf.String(), "RootPass1234") {
+		t.Errorf("log output %q still contains the secret", buf.String())
+	}
+	if !strings.Contains(buf.String(), "Error provision store s1") {
+		t.Errorf("log output %q lost the message", buf.String())
+	}
+}
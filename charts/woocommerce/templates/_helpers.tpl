@@ -40,6 +40,9 @@ helm.sh/chart: {{ include "woocommerce-store.chart" . }}
 app.kubernetes.io/version: {{ .Chart.AppVersion | quote }}
 {{- end }}
 app.kubernetes.io/managed-by: {{ .Release.Service }}
+{{- with .Values.storeId }}
+urumi.io/store-id: {{ . | quote }}
+{{- end }}
 {{- end }}
 
 {{/*
@@ -5,6 +5,8 @@ import StoreList from './components/StoreList';
 import CreateStoreModal from './components/CreateStoreModal';
 import ErrorBoundary from './components/ErrorBoundary';
 
+const WATCH_ERROR = 'Lost connection to the backend, reconnecting...';
+
 function App() {
     const [stores, setStores] = useState([]);
     const [isModalOpen, setIsModalOpen] = useState(false);
@@ -25,9 +27,29 @@ function App() {
     };
 
     useEffect(() => {
-        fetchStores();
-        const interval = setInterval(fetchStores, 5000); // Poll every 5s
-        return () => clearInterval(interval);
+        // Stream store changes instead of polling. EventSource reconnects on its own
+        // and resumes with Last-Event-ID, or gets a fresh snapshot if it was away too long.
+        const source = new EventSource('/api/stores/watch');
+        const upsertStore = (event) => {
+            const store = JSON.parse(event.data);
+            setStores((prev) => {
+                const index = prev.findIndex((s) => s.id === store.id);
+                if (index === -1) return [...prev, store];
+                const next = [...prev];
+                next[index] = store;
+                return next;
+            });
+        };
+        source.addEventListener('snapshot', (event) => setStores(JSON.parse(event.data)));
+        source.addEventListener('created', upsertStore);
+        source.addEventListener('updated', upsertStore);
+        source.addEventListener('deleted', (event) => {
+            const store = JSON.parse(event.data);
+            setStores((prev) => prev.filter((s) => s.id !== store.id));
+        });
+        source.onopen = () => setError((prev) => (prev === WATCH_ERROR ? null : prev));
+        source.onerror = () => setError(WATCH_ERROR);
+        return () => source.close();
     }, []);
 
     const handleCreateStore = async (storeData) => {
@@ -59,6 +81,31 @@ function App() {
         }
     };
 
+    const handleRetryStore = async (id) => {
+        try {
+            setError(null);
+            await axios.post(`/api/stores/${id}/retry`, {});
+            fetchStores();
+        } catch (error) {
+            console.error('Error retrying store:', error);
+            const errorMessage = error.response?.data?.error || 'Failed to retry store';
+            setError(errorMessage);
+        }
+    };
+
+    const handleCancelStore = async (id) => {
+        if (!confirm('Cancel provisioning? Partially created resources will be removed.')) return;
+        try {
+            setError(null);
+            await axios.post(`/api/stores/${id}/cancel`, {});
+            fetchStores();
+        } catch (error) {
+            console.error('Error cancelling store:', error);
+            const errorMessage = error.response?.data?.error || 'Failed to cancel store';
+            setError(errorMessage);
+        }
+    };
+
     return (
         <ErrorBoundary>
             <div className="min-h-screen selection:bg-violet-500/30">
@@ -136,7 +183,7 @@ function App() {
                 </div>
 
                 <div className="animate-fade-in-up" style={{ animationDelay: '0.1s' }}>
-                    <StoreList stores={stores} onDelete={handleDeleteStore} isLoading={isLoading} />
+                    <StoreList stores={stores} onDelete={handleDeleteStore} onRetry={handleRetryStore} onCancel={handleCancelStore} isLoading={isLoading} />
                 </div>
             </main>
 
@@ -1,11 +1,26 @@
-import React, { useState } from 'react';
+import React, { useEffect, useState } from 'react';
+import axios from 'axios';
 import { X, Sparkles, Server } from 'lucide-react';
 
 export default function CreateStoreModal({ isOpen, onClose, onCreate, isLoading }) {
     const [name, setName] = useState('');
-    const [type, setType] = useState('woocommerce');
+    const [type, setType] = useState('');
+    const [storeTypes, setStoreTypes] = useState([]);
+    const [keepOnFailure, setKeepOnFailure] = useState(false);
     const [isSubmitting, setIsSubmitting] = useState(false);
 
+    // Store types come from the backend's catalog
+    useEffect(() => {
+        if (!isOpen) return;
+        axios.get('/api/store-types')
+            .then((response) => {
+                const types = response.data.types || [];
+                setStoreTypes(types);
+                setType((current) => current || (types[0] && types[0].name) || '');
+            })
+            .catch((error) => console.error('Failed to load store types:', error));
+    }, [isOpen]);
+
     if (!isOpen) return null;
 
     const handleSubmit = async (e) => {
@@ -14,10 +29,11 @@ export default function CreateStoreModal({ isOpen, onClose, onCreate, isLoading
         
         setIsSubmitting(true);
         try {
-            await onCreate({ name, type });
+            await onCreate({ name, type, keep_on_failure: keepOnFailure });
             onClose();
             setName('');
-            setType('woocommerce');
+            setType(storeTypes[0] ? storeTypes[0].name : '');
+            setKeepOnFailure(false);
         } catch (error) {
             // Error is handled by parent component
             console.error('Create store error:', error);
@@ -65,35 +81,38 @@ export default function CreateStoreModal({ isOpen, onClose, onCreate, isLoading
                     <div className="space-y-4">
                         <label className="text-xs font-semibold text-slate-400 uppercase tracking-wider">Store Engine</label>
                         <div className="grid grid-cols-2 gap-4">
-                            <button
-                                type="button"
-                                disabled={isSubmitting}
-                                className={`p-4 rounded-xl border flex flex-col items-center gap-3 transition-all duration-200 ${type === 'woocommerce' ? 'bg-violet-500/20 border-violet-500/50 text-white shadow-[0_0_15px_rgba(139,92,246,0.15)] scale-[1.02]' : 'bg-slate-900/40 border-slate-700/30 text-slate-400 hover:bg-slate-800/60 hover:border-slate-600'} disabled:opacity-50 disabled:cursor-not-allowed`}
-                                onClick={() => setType('woocommerce')}
-                            >
-                                <div className={`w-10 h-10 rounded-full flex items-center justify-center ${type === 'woocommerce' ? 'bg-violet-500' : 'bg-slate-800'}`}>
-                                    <span className="text-lg font-bold">W</span>
-                                </div>
-                                <span className="font-semibold text-sm">WooCommerce</span>
-                            </button>
-
-                            <button
-                                type="button"
-                                disabled={isSubmitting}
-                                className={`p-4 rounded-xl border flex flex-col items-center gap-3 transition-all duration-200 ${type === 'medusa' ? 'bg-violet-500/20 border-violet-500/50 text-white shadow-[0_0_15px_rgba(139,92,246,0.15)] scale-[1.02]' : 'bg-slate-900/40 border-slate-700/30 text-slate-400 hover:bg-slate-800/60 hover:border-slate-600'} disabled:opacity-50 disabled:cursor-not-allowed`}
-                                onClick={() => setType('medusa')}
-                            >
-                                <div className={`w-10 h-10 rounded-full flex items-center justify-center ${type === 'medusa' ? 'bg-violet-500' : 'bg-slate-800'}`}>
-                                    <span className="text-lg font-bold">M</span>
-                                </div>
-                                <span className="font-semibold text-sm">MedusaJS</span>
-                            </button>
+                            {storeTypes.map((storeType) => (
+                                <button
+                                    key={storeType.name}
+                                    type="button"
+                                    disabled={isSubmitting}
+                                    title={storeType.description}
+                                    className={`p-4 rounded-xl border flex flex-col items-center gap-3 transition-all duration-200 ${type === storeType.name ? 'bg-violet-500/20 border-violet-500/50 text-white shadow-[0_0_15px_rgba(139,92,246,0.15)] scale-[1.02]' : 'bg-slate-900/40 border-slate-700/30 text-slate-400 hover:bg-slate-800/60 hover:border-slate-600'} disabled:opacity-50 disabled:cursor-not-allowed`}
+                                    onClick={() => setType(storeType.name)}
+                                >
+                                    <div className={`w-10 h-10 rounded-full flex items-center justify-center ${type === storeType.name ? 'bg-violet-500' : 'bg-slate-800'}`}>
+                                        <span className="text-lg font-bold">{(storeType.display_name || storeType.name).charAt(0).toUpperCase()}</span>
+                                    </div>
+                                    <span className="font-semibold text-sm">{storeType.display_name || storeType.name}</span>
+                                </button>
+                            ))}
                         </div>
                     </div>
 
+                    <label className="flex items-center gap-3 text-sm text-slate-400 cursor-pointer">
+                        <input
+                            type="checkbox"
+                            checked={keepOnFailure}
+                            onChange={(e) => setKeepOnFailure(e.target.checked)}
+                            disabled={isSubmitting}
+                            className="w-4 h-4 rounded accent-violet-500"
+                        />
+                        Keep resources for debugging if provisioning fails
+                    </label>
+
                     <button
                         type="submit"
-                        disabled={isSubmitting || isLoading || !name.trim()}
+                        disabled={isSubmitting || isLoading || !name.trim() || !type}
                         className="w-full py-4 rounded-xl bg-white hover:bg-slate-200 text-slate-950 font-bold shadow-lg shadow-white/5 transition-all active:scale-[0.98] disabled:opacity-70 disabled:cursor-not-allowed flex items-center justify-center gap-2 mt-2"
                     >
                         {(isSubmitting || isLoading) ? <Server className="w-4 h-4 animate-spin" /> : 'Launch Store'}
@@ -1,13 +1,16 @@
 import React from 'react';
-import { ExternalLink, Trash2, Box, RefreshCw, ShoppingCart, Globe, Clock } from 'lucide-react';
+import { ExternalLink, Trash2, Box, RefreshCw, ShoppingCart, Globe, Clock, XCircle } from 'lucide-react';
 
 const StoreStatus = ({ status }) => {
     const styles = {
         Provisioning: "bg-amber-500/10 text-amber-500 border-amber-500/20 shadow-[0_0_10px_rgba(245,158,11,0.1)]",
         Ready: "bg-emerald-500/10 text-emerald-500 border-emerald-500/20 shadow-[0_0_10px_rgba(16,185,129,0.1)]",
         Failed: "bg-red-500/10 text-red-500 border-red-500/20 shadow-[0_0_10px_rgba(239,68,68,0.1)]",
+        Degraded: "bg-orange-500/10 text-orange-500 border-orange-500/20 shadow-[0_0_10px_rgba(249,115,22,0.1)]",
+        Lost: "bg-red-500/10 text-red-500 border-red-500/20 shadow-[0_0_10px_rgba(239,68,68,0.1)]",
         Deleting: "bg-slate-500/10 text-slate-500 border-slate-500/20 shadow-[0_0_10px_rgba(148,163,184,0.1)]",
         DeletionFailed: "bg-red-500/10 text-red-500 border-red-500/20 shadow-[0_0_10px_rgba(239,68,68,0.1)]",
+        Cancelled: "bg-slate-500/10 text-slate-400 border-slate-500/20 shadow-[0_0_10px_rgba(148,163,184,0.1)]",
     };
 
     const statusStyle = styles[status] || "bg-slate-500/10 text-slate-500";
@@ -18,13 +21,16 @@ const StoreStatus = ({ status }) => {
             {status === 'Deleting' && <RefreshCw className="w-3 h-3 animate-spin" />}
             {status === 'Ready' && <div className="w-1.5 h-1.5 rounded-full bg-emerald-500 animate-pulse" />}
             {status === 'Failed' && <div className="w-1.5 h-1.5 rounded-full bg-red-500" />}
+            {status === 'Degraded' && <div className="w-1.5 h-1.5 rounded-full bg-orange-500 animate-pulse" />}
+            {status === 'Lost' && <div className="w-1.5 h-1.5 rounded-full bg-red-500" />}
             {status === 'DeletionFailed' && <div className="w-1.5 h-1.5 rounded-full bg-red-500" />}
+            {status === 'Cancelled' && <div className="w-1.5 h-1.5 rounded-full bg-slate-400" />}
             {status}
         </div>
     );
 };
 
-const StoreCard = ({ store, onDelete, isLoading }) => {
+const StoreCard = ({ store, onDelete, onRetry, onCancel, isLoading }) => {
     const isDeleting = store.status === 'Deleting';
     const canDelete = !isDeleting && store.status !== 'Deleting';
     
@@ -64,16 +70,65 @@ const StoreCard = ({ store, onDelete, isLoading }) => {
                 </div>
             </div>
 
+            {/* Status Reason */}
+            {store.status_reason && store.status !== 'Ready' && (
+                <p className="relative z-10 mb-4 text-xs text-slate-400">
+                    {store.status_reason}
+                    {store.provision_attempts > 1 && ` · ${store.provision_attempts} install attempts`}
+                </p>
+            )}
+
+            {/* Conditions */}
+            {store.conditions && store.conditions.length > 0 && (
+                <div className="relative z-10 mb-4 flex flex-wrap gap-1.5">
+                    {store.conditions.map(condition => (
+                        <span
+                            key={condition.type}
+                            title={[condition.reason, condition.message].filter(Boolean).join(': ')}
+                            className={`px-2 py-0.5 rounded-md text-[10px] font-medium border ${
+                                condition.status === 'True'
+                                    ? 'bg-emerald-500/10 text-emerald-400 border-emerald-500/20'
+                                    : condition.status === 'False'
+                                        ? 'bg-red-500/10 text-red-400 border-red-500/20'
+                                        : 'bg-slate-500/10 text-slate-400 border-slate-500/20'
+                            }`}
+                        >
+                            {condition.type}
+                        </span>
+                    ))}
+                </div>
+            )}
+
             {/* Error Message Display */}
-            {store.error_message && (
+            {store.error_code && (
                 <div className="relative z-10 mb-4">
-                    <p className="text-sm font-medium text-red-400 mb-1">Error:</p>
+                    <p className="text-sm font-medium text-red-400 mb-1">Error: <span className="font-mono">{store.error_code}</span></p>
                     <div className="text-xs text-red-300 bg-red-500/10 p-2 rounded border border-red-500/20">
-                        {store.error_message}
+                        {store.error_hint}
+                        {store.provision_attempts > 0 && (
+                            <a
+                                href={`/api/stores/${store.id}/provision-attempts/${store.provision_attempts}/log`}
+                                className="block mt-1 underline text-red-200 hover:text-white"
+                            >
+                                Download install log
+                            </a>
+                        )}
                     </div>
                 </div>
             )}
 
+            {/* Leftover Resources */}
+            {store.leftover_resources && store.leftover_resources.length > 0 && (
+                <div className="relative z-10 mb-4">
+                    <p className="text-sm font-medium text-amber-400 mb-1">Left in cluster:</p>
+                    <ul className="text-xs text-amber-300/80 bg-amber-500/10 p-2 rounded border border-amber-500/20 space-y-0.5 font-mono">
+                        {store.leftover_resources.map(resource => (
+                            <li key={resource}>{resource}</li>
+                        ))}
+                    </ul>
+                </div>
+            )}
+
             <div className="relative z-10 mb-4">
                 <p className="text-sm font-medium text-slate-400 mb-1">Products:</p>
                 <div className="text-sm text-white">
@@ -95,9 +150,18 @@ const StoreCard = ({ store, onDelete, isLoading }) => {
                     </a>
                 )}
 
-                {store.status === 'Failed' && (
+                {store.status === 'Provisioning' && (
                     <button
-                        onClick={() => onDelete(store.id)}
+                        onClick={() => onCancel(store.id)}
+                        className="flex items-center justify-center gap-2 w-full py-2.5 rounded-xl bg-amber-500/10 text-amber-400 hover:bg-amber-500/20 transition-all text-sm font-medium border border-amber-500/20"
+                    >
+                        Cancel Provisioning <XCircle className="w-4 h-4" />
+                    </button>
+                )}
+
+                {(store.status === 'Failed' || store.status === 'Lost' || store.status === 'Cancelled') && (
+                    <button
+                        onClick={() => onRetry(store.id)}
                         className="flex items-center justify-center gap-2 w-full py-2.5 rounded-xl bg-red-500/20 text-red-400 hover:bg-red-500/30 transition-all text-sm font-medium border border-red-500/20"
                     >
                         Retry Deployment <RefreshCw className="w-4 h-4" />
@@ -127,7 +191,7 @@ const StoreCard = ({ store, onDelete, isLoading }) => {
     );
 };
 
-export default function StoreList({ stores, onDelete, isLoading }) {
+export default function StoreList({ stores, onDelete, onRetry, onCancel, isLoading }) {
     if (isLoading && stores.length === 0) {
         return (
             <div className="text-center py-24 glass-panel rounded-3xl border-dashed border-slate-700/50">
@@ -159,7 +223,7 @@ export default function StoreList({ stores, onDelete, isLoading }) {
     return (
         <div className="grid grid-cols-1 md:grid-cols-2 lg:grid-cols-3 gap-6">
             {stores.map(store => (
-                <StoreCard key={store.id} store={store} onDelete={onDelete} isLoading={isLoading} />
+                <StoreCard key={store.id} store={store} onDelete={onDelete} onRetry={onRetry} onCancel={onCancel} isLoading={isLoading} />
             ))}
         </div>
     );